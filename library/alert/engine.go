@@ -0,0 +1,217 @@
+package alert
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"checker/library/metric"
+	"checker/library/stream"
+
+	"github.com/gin-gonic/gin"
+)
+
+// resolvedRetention is how long resolved alerts stay visible.
+const resolvedRetention = 15 * time.Minute
+
+type State string
+
+const (
+	StatePending  State = "pending"
+	StateFiring   State = "firing"
+	StateResolved State = "resolved"
+	// StateInactive is published once for a pending alert whose condition
+	// cleared, or whose series went away, before it fired. Inactive alerts
+	// are not kept.
+	StateInactive State = "inactive"
+)
+
+// Alert is the state of one rule for one series.
+type Alert struct {
+	Fingerprint string            `json:"fingerprint"`
+	Rule        string            `json:"rule"`
+	Metric      string            `json:"metric"`
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	State       State             `json:"state"`
+	Value       float64           `json:"value"`
+	Threshold   float64           `json:"threshold"`
+	ActiveAt    time.Time         `json:"active_at"`
+	FiredAt     *time.Time        `json:"fired_at,omitempty"`
+	// ResolvedAt is when the alert resolved or went inactive.
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
+
+// Engine evaluates rules against metric points and tracks the
+// pending/firing/resolved state of every alert.
+type Engine struct {
+	mu      sync.Mutex
+	rules   []Rule
+	sources map[string]string // metric name -> source producing it
+	alerts  map[string]*Alert
+	hub     *stream.Hub
+}
+
+func NewEngine(rules []Rule) *Engine {
+	return &Engine{
+		rules:   rules,
+		sources: make(map[string]string),
+		alerts:  make(map[string]*Alert),
+		hub:     stream.NewHub(),
+	}
+}
+
+// Hub publishes a copy of an alert on every state change.
+func (e *Engine) Hub() *stream.Hub {
+	return e.hub
+}
+
+// Evaluate applies the rules to the points produced by source at t.
+// Alerts of series the source no longer reports are resolved.
+func (e *Engine) Evaluate(source string, t time.Time, points []metric.Point) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	seen := make(map[string]bool)
+	for _, p := range points {
+		if p.Counter {
+			continue
+		}
+		e.sources[p.Name] = source
+
+		for _, rule := range e.rules {
+			if rule.Metric != p.Name || !metric.Matches(p.Labels, rule.Selector) {
+				continue
+			}
+			fingerprint := rule.Name + "/" + metric.Key(p.Name, p.Labels)
+			seen[fingerprint] = true
+			e.step(rule, fingerprint, p, t)
+		}
+	}
+
+	for fingerprint, a := range e.alerts {
+		if seen[fingerprint] || e.sources[a.Metric] != source {
+			continue
+		}
+		switch a.State {
+		case StatePending:
+			e.deactivate(a, t)
+		case StateFiring:
+			e.resolve(a, t)
+		}
+	}
+
+	for fingerprint, a := range e.alerts {
+		if a.State == StateResolved && t.Sub(*a.ResolvedAt) > resolvedRetention {
+			delete(e.alerts, fingerprint)
+		}
+	}
+}
+
+func (e *Engine) step(rule Rule, fingerprint string, p metric.Point, t time.Time) {
+	a, ok := e.alerts[fingerprint]
+	if ok && a.State != StateResolved {
+		a.Value = p.Value
+	}
+
+	switch {
+	case (!ok || a.State == StateResolved) && rule.active(p.Value):
+		labels := make(map[string]string, len(p.Labels)+len(rule.Labels)+1)
+		for k, v := range p.Labels {
+			labels[k] = v
+		}
+		for k, v := range rule.Labels {
+			labels[k] = v
+		}
+		labels["alertname"] = rule.Name
+
+		a = &Alert{
+			Fingerprint: fingerprint,
+			Rule:        rule.Name,
+			Metric:      rule.Metric,
+			Labels:      labels,
+			Annotations: rule.annotate(p.Labels, p.Value),
+			State:       StatePending,
+			Value:       p.Value,
+			Threshold:   rule.Threshold,
+			ActiveAt:    t,
+		}
+		e.alerts[fingerprint] = a
+		if rule.For > 0 {
+			e.publish(a)
+			return
+		}
+		e.fire(a, t)
+
+	case ok && a.State == StatePending && !rule.active(p.Value):
+		e.deactivate(a, t)
+
+	case ok && a.State == StatePending && t.Sub(a.ActiveAt) >= rule.For:
+		a.Annotations = rule.annotate(p.Labels, p.Value)
+		e.fire(a, t)
+
+	case ok && a.State == StateFiring && !rule.holding(p.Value):
+		e.resolve(a, t)
+	}
+}
+
+func (e *Engine) fire(a *Alert, t time.Time) {
+	a.State = StateFiring
+	a.FiredAt = &t
+	e.publish(a)
+}
+
+func (e *Engine) resolve(a *Alert, t time.Time) {
+	a.State = StateResolved
+	a.ResolvedAt = &t
+	e.publish(a)
+}
+
+// deactivate drops a pending alert, publishing it as inactive so
+// subscribers that saw it pending learn that it will not fire.
+func (e *Engine) deactivate(a *Alert, t time.Time) {
+	a.State = StateInactive
+	a.ResolvedAt = &t
+	delete(e.alerts, a.Fingerprint)
+	e.publish(a)
+}
+
+func (e *Engine) publish(a *Alert) {
+	e.hub.Publish(*a)
+}
+
+// Alerts returns the current alerts, optionally limited to one state,
+// firing first and then by activation time.
+func (e *Engine) Alerts(state State) []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	alerts := make([]Alert, 0, len(e.alerts))
+	for _, a := range e.alerts {
+		if state == "" || a.State == state {
+			alerts = append(alerts, *a)
+		}
+	}
+
+	rank := map[State]int{StateFiring: 0, StatePending: 1, StateResolved: 2}
+	sort.Slice(alerts, func(i, j int) bool {
+		if rank[alerts[i].State] != rank[alerts[j].State] {
+			return rank[alerts[i].State] < rank[alerts[j].State]
+		}
+		return alerts[i].ActiveAt.Before(alerts[j].ActiveAt)
+	})
+	return alerts
+}
+
+// Handler serves the current alerts; ?state= filters by state.
+func (e *Engine) Handler(c *gin.Context) {
+	state := State(c.Query("state"))
+	switch state {
+	case "", StatePending, StateFiring, StateResolved:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid state " + string(state)})
+		return
+	}
+	c.JSON(http.StatusOK, e.Alerts(state))
+}
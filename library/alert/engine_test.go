@@ -0,0 +1,103 @@
+package alert
+
+import (
+	"testing"
+	"time"
+
+	"checker/library/metric"
+)
+
+// published drains the events published so far.
+func published(events <-chan interface{}) []Alert {
+	var alerts []Alert
+	for {
+		select {
+		case event := <-events:
+			alerts = append(alerts, event.(Alert))
+		default:
+			return alerts
+		}
+	}
+}
+
+func states(alerts []Alert) []State {
+	var s []State
+	for _, a := range alerts {
+		s = append(s, a.State)
+	}
+	return s
+}
+
+func newTestEngine(t *testing.T) (*Engine, <-chan interface{}) {
+	t.Helper()
+	rule, err := Compile(RuleSpec{Name: "high-load", Expr: "cpu.load > 5 for 1m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewEngine([]Rule{rule})
+	events, unsubscribe := e.Hub().Subscribe()
+	t.Cleanup(unsubscribe)
+	return e, events
+}
+
+func load(v float64) []metric.Point {
+	return []metric.Point{{Name: "cpu.load", Labels: map[string]string{"host": "a"}, Value: v}}
+}
+
+func TestPendingClearedIsPublishedInactive(t *testing.T) {
+	e, events := newTestEngine(t)
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	e.Evaluate("cpu", start, load(10))
+	e.Evaluate("cpu", start.Add(10*time.Second), load(1))
+
+	got := published(events)
+	if len(got) != 2 || got[0].State != StatePending || got[1].State != StateInactive {
+		t.Fatalf("published %v, want pending then inactive", states(got))
+	}
+	if got[1].ResolvedAt == nil || !got[1].ResolvedAt.Equal(start.Add(10*time.Second)) {
+		t.Errorf("inactive ResolvedAt = %v", got[1].ResolvedAt)
+	}
+	if got[1].Fingerprint != got[0].Fingerprint {
+		t.Errorf("inactive fingerprint %q, pending %q", got[1].Fingerprint, got[0].Fingerprint)
+	}
+	if alerts := e.Alerts(""); len(alerts) != 0 {
+		t.Errorf("Alerts = %v, want none", alerts)
+	}
+}
+
+func TestPendingSeriesGoneIsPublishedInactive(t *testing.T) {
+	e, events := newTestEngine(t)
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	e.Evaluate("cpu", start, load(10))
+	// Another source's points leave the series alone.
+	e.Evaluate("disk", start.Add(5*time.Second), []metric.Point{{Name: "disk.used_percent", Value: 1}})
+	e.Evaluate("cpu", start.Add(10*time.Second), nil)
+
+	if got := states(published(events)); len(got) != 2 || got[0] != StatePending || got[1] != StateInactive {
+		t.Fatalf("published %v, want pending then inactive", got)
+	}
+	if alerts := e.Alerts(""); len(alerts) != 0 {
+		t.Errorf("Alerts = %v, want none", alerts)
+	}
+}
+
+func TestFiringAndResolving(t *testing.T) {
+	e, events := newTestEngine(t)
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	e.Evaluate("cpu", start, load(10))
+	e.Evaluate("cpu", start.Add(30*time.Second), load(10))
+	e.Evaluate("cpu", start.Add(time.Minute), load(10))
+	e.Evaluate("cpu", start.Add(90*time.Second), load(1))
+
+	got := states(published(events))
+	want := []State{StatePending, StateFiring, StateResolved}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Fatalf("published %v, want %v", got, want)
+	}
+	if alerts := e.Alerts(StateResolved); len(alerts) != 1 {
+		t.Errorf("resolved alerts = %v, want one", alerts)
+	}
+}
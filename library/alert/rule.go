@@ -0,0 +1,228 @@
+package alert
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RuleSpec is a rule as written in the rule file:
+//
+//	rules:
+//	  - name: HighMemory
+//	    expr: memory.used_memory_percent > 90 for 5m
+//	    clear: 85
+//	    labels: {severity: warning}
+//	    annotations:
+//	      summary: "Memory at {{ .Value }}%"
+type RuleSpec struct {
+	Name        string            `yaml:"name"`
+	Expr        string            `yaml:"expr"`
+	For         string            `yaml:"for"`
+	Clear       *float64          `yaml:"clear"`
+	Labels      map[string]string `yaml:"labels"`
+	Annotations map[string]string `yaml:"annotations"`
+}
+
+type ruleFile struct {
+	Rules []RuleSpec `yaml:"rules"`
+}
+
+// Rule is a compiled threshold rule.
+type Rule struct {
+	Name      string
+	Metric    string
+	Selector  map[string]string
+	Op        string
+	Threshold float64
+	For       time.Duration
+	// Clear is the threshold the value has to cross back over before a
+	// firing alert resolves. It defaults to Threshold.
+	Clear       float64
+	Labels      map[string]string
+	Annotations map[string]*template.Template
+}
+
+var exprPattern = regexp.MustCompile(`^\s*([A-Za-z_][\w.]*)\s*(\{[^}]*\})?\s*(>=|<=|==|!=|>|<)\s*(\S+)\s*(?:for\s+(\S+))?\s*$`)
+
+// ParseExpr parses an expression such as
+// `disk.used_percent{mountpoint="/"} > 85 for 5m`.
+func ParseExpr(expr string) (metric string, selector map[string]string, op string, threshold float64, forDuration time.Duration, err error) {
+	m := exprPattern.FindStringSubmatch(expr)
+	if m == nil {
+		return "", nil, "", 0, 0, fmt.Errorf("invalid expression %q, expected <metric>{labels} <op> <number> [for <duration>]", expr)
+	}
+
+	metric, op = m[1], m[3]
+	if selector, err = parseSelector(m[2]); err != nil {
+		return "", nil, "", 0, 0, err
+	}
+	if threshold, err = strconv.ParseFloat(m[4], 64); err != nil {
+		return "", nil, "", 0, 0, fmt.Errorf("invalid threshold %q", m[4])
+	}
+	if m[5] != "" {
+		if forDuration, err = time.ParseDuration(m[5]); err != nil {
+			return "", nil, "", 0, 0, fmt.Errorf("invalid for duration %q", m[5])
+		}
+	}
+	return metric, selector, op, threshold, forDuration, nil
+}
+
+func parseSelector(s string) (map[string]string, error) {
+	selector := make(map[string]string)
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "{"), "}")
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid label matcher %q", pair)
+		}
+		value = strings.TrimSpace(value)
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		}
+		selector[strings.TrimSpace(name)] = value
+	}
+	return selector, nil
+}
+
+// Compile validates a rule spec.
+func Compile(spec RuleSpec) (Rule, error) {
+	if spec.Name == "" {
+		return Rule{}, errors.New("rule has no name")
+	}
+
+	metric, selector, op, threshold, forDuration, err := ParseExpr(spec.Expr)
+	if err != nil {
+		return Rule{}, fmt.Errorf("rule %s: %v", spec.Name, err)
+	}
+	if spec.For != "" {
+		if forDuration, err = time.ParseDuration(spec.For); err != nil {
+			return Rule{}, fmt.Errorf("rule %s: invalid for %q", spec.Name, spec.For)
+		}
+	}
+
+	rule := Rule{
+		Name:        spec.Name,
+		Metric:      metric,
+		Selector:    selector,
+		Op:          op,
+		Threshold:   threshold,
+		For:         forDuration,
+		Clear:       threshold,
+		Labels:      spec.Labels,
+		Annotations: make(map[string]*template.Template),
+	}
+
+	if spec.Clear != nil {
+		rule.Clear = *spec.Clear
+		switch {
+		case op == "==" || op == "!=":
+			return Rule{}, fmt.Errorf("rule %s: clear cannot be used with %s", spec.Name, op)
+		case (op == ">" || op == ">=") && rule.Clear > threshold:
+			return Rule{}, fmt.Errorf("rule %s: clear must not be above the threshold", spec.Name)
+		case (op == "<" || op == "<=") && rule.Clear < threshold:
+			return Rule{}, fmt.Errorf("rule %s: clear must not be below the threshold", spec.Name)
+		}
+	}
+
+	for key, text := range spec.Annotations {
+		tmpl, err := template.New(key).Parse(text)
+		if err != nil {
+			return Rule{}, fmt.Errorf("rule %s: annotation %s: %v", spec.Name, key, err)
+		}
+		rule.Annotations[key] = tmpl
+	}
+	return rule, nil
+}
+
+// LoadRules reads and compiles a YAML rule file.
+func LoadRules(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file ruleFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	rules := make([]Rule, 0, len(file.Rules))
+	seen := make(map[string]bool)
+	for _, spec := range file.Rules {
+		rule, err := Compile(spec)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if seen[rule.Name] {
+			return nil, fmt.Errorf("%s: duplicate rule %s", path, rule.Name)
+		}
+		seen[rule.Name] = true
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func compare(op string, value, threshold float64) bool {
+	switch op {
+	case ">":
+		return value > threshold
+	case ">=":
+		return value >= threshold
+	case "<":
+		return value < threshold
+	case "<=":
+		return value <= threshold
+	case "==":
+		return value == threshold
+	case "!=":
+		return value != threshold
+	}
+	return false
+}
+
+// active reports whether value triggers the rule.
+func (r Rule) active(value float64) bool {
+	return compare(r.Op, value, r.Threshold)
+}
+
+// holding reports whether a firing alert should keep firing.
+func (r Rule) holding(value float64) bool {
+	return compare(r.Op, value, r.Clear)
+}
+
+func (r Rule) annotate(labels map[string]string, value float64) map[string]string {
+	if len(r.Annotations) == 0 {
+		return nil
+	}
+
+	data := struct {
+		Labels    map[string]string
+		Value     float64
+		Threshold float64
+	}{labels, value, r.Threshold}
+
+	annotations := make(map[string]string, len(r.Annotations))
+	for key, tmpl := range r.Annotations {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			annotations[key] = err.Error()
+			continue
+		}
+		annotations[key] = buf.String()
+	}
+	return annotations
+}
@@ -0,0 +1,210 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Scopes guarding the route groups. ScopeAll grants every scope.
+const (
+	ScopeMetrics = "metrics"
+	ScopeStream  = "stream"
+	ScopeHistory = "history"
+	ScopeAlerts  = "alerts"
+	ScopeAll     = "*"
+)
+
+// identityKey is where the authenticated Identity is stored on the gin
+// context.
+const identityKey = "auth.identity"
+
+// Identity is who made a request and what they may access.
+type Identity struct {
+	Name   string
+	Method string
+	Scopes []string
+}
+
+func (id Identity) HasScope(scope string) bool {
+	return contains(id.Scopes, scope) || contains(id.Scopes, ScopeAll)
+}
+
+// APIKey is a static key granting a set of scopes.
+type APIKey struct {
+	Name   string
+	Key    string
+	Scopes []string
+}
+
+type hashedKey struct {
+	name   string
+	sum    [sha256.Size]byte
+	scopes []string
+}
+
+// Authenticator checks API keys, JWT bearer tokens and verified TLS client
+// certificates. With none configured every request is let through.
+type Authenticator struct {
+	keys []hashedKey
+	jwt  *JWTConfig
+	now  func() time.Time
+	// certScopes are granted to clients presenting a verified certificate;
+	// nil disables client certificate authentication.
+	certScopes []string
+}
+
+func New(keys []APIKey, jwt *JWTConfig) *Authenticator {
+	a := &Authenticator{jwt: jwt, now: time.Now}
+	for _, k := range keys {
+		a.keys = append(a.keys, hashedKey{name: k.Name, sum: sha256.Sum256([]byte(k.Key)), scopes: k.Scopes})
+	}
+	return a
+}
+
+// TrustClientCertificates authenticates clients that present a TLS client
+// certificate verified by the server with the given scopes. The identity
+// is named after the certificate's common name.
+func (a *Authenticator) TrustClientCertificates(scopes []string) {
+	a.certScopes = append([]string{}, scopes...)
+}
+
+// Enabled reports whether any credentials are configured.
+func (a *Authenticator) Enabled() bool {
+	return len(a.keys) > 0 || a.jwt != nil || a.certScopes != nil
+}
+
+var errNoCredentials = errors.New("missing credentials")
+
+// credential extracts the presented secret from the X-API-Key header, an
+// Authorization bearer token, or, for websocket upgrades which browsers
+// cannot add headers to, the access_token query parameter. A token in the
+// URL can end up in proxy logs and browser history, so clients that can
+// set headers should; the server's own request log redacts it with
+// RedactToken.
+func credential(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if h := r.Header.Get("Authorization"); len(h) > 7 && strings.EqualFold(h[:7], "bearer ") {
+		return strings.TrimSpace(h[7:])
+	}
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return r.URL.Query().Get("access_token")
+	}
+	return ""
+}
+
+// RedactToken replaces the value of any access_token parameter in the
+// query of path.
+func RedactToken(path string) string {
+	base, query, ok := strings.Cut(path, "?")
+	if !ok {
+		return path
+	}
+	params := strings.Split(query, "&")
+	for i, param := range params {
+		if name, _, _ := strings.Cut(param, "="); name == "access_token" {
+			params[i] = "access_token=REDACTED"
+		}
+	}
+	return base + "?" + strings.Join(params, "&")
+}
+
+// Authenticate returns the identity presenting the request's credential.
+func (a *Authenticator) Authenticate(r *http.Request) (Identity, error) {
+	secret := credential(r)
+	if secret == "" {
+		if a.certScopes != nil && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+			cert := r.TLS.VerifiedChains[0][0]
+			return Identity{Name: cert.Subject.CommonName, Method: "client_cert", Scopes: a.certScopes}, nil
+		}
+		return Identity{}, errNoCredentials
+	}
+
+	// Compare against every key so timing does not reveal which matched.
+	sum := sha256.Sum256([]byte(secret))
+	var match *hashedKey
+	for i := range a.keys {
+		if subtle.ConstantTimeCompare(sum[:], a.keys[i].sum[:]) == 1 {
+			match = &a.keys[i]
+		}
+	}
+	if match != nil {
+		return Identity{Name: match.name, Method: "api_key", Scopes: match.scopes}, nil
+	}
+
+	if a.jwt != nil && strings.Count(secret, ".") == 2 {
+		return verifyJWT(a.jwt, secret, a.now())
+	}
+	return Identity{}, errors.New("invalid credentials")
+}
+
+// Require returns middleware rejecting requests without a credential
+// granting scope: 401 when the credential is missing or invalid, 403 when
+// it lacks the scope.
+func (a *Authenticator) Require(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !a.Enabled() {
+			c.Next()
+			return
+		}
+
+		id, err := a.Authenticate(c.Request)
+		if err != nil {
+			c.Header("WWW-Authenticate", `Bearer realm="uptimex"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		if !id.HasScope(scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "missing scope " + scope})
+			return
+		}
+
+		c.Set(identityKey, id)
+		c.Next()
+	}
+}
+
+// FromContext returns the identity authenticated for the request, if any.
+func FromContext(c *gin.Context) (Identity, bool) {
+	v, ok := c.Get(identityKey)
+	if !ok {
+		return Identity{}, false
+	}
+	id, ok := v.(Identity)
+	return id, ok
+}
+
+// OriginChecker returns a websocket CheckOrigin function allowing requests
+// without an Origin header (non-browser clients), same-origin requests and
+// the listed origins. "*" allows any origin.
+func OriginChecker(allowed []string) func(r *http.Request) bool {
+	allowAll := contains(allowed, "*")
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" || allowAll {
+			return true
+		}
+
+		u, err := url.Parse(origin)
+		if err != nil {
+			return false
+		}
+		if strings.EqualFold(u.Host, r.Host) {
+			return true
+		}
+		for _, o := range allowed {
+			if strings.EqualFold(strings.TrimSuffix(o, "/"), origin) {
+				return true
+			}
+		}
+		return false
+	}
+}
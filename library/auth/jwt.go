@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+	"time"
+)
+
+// JWTConfig verifies HMAC-signed (HS256/384/512) bearer tokens.
+type JWTConfig struct {
+	Secret   []byte
+	Issuer   string
+	Audience string
+	// Leeway tolerates clock skew when checking exp and nbf.
+	Leeway time.Duration
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+}
+
+// audience accepts both the string and the array form of "aud".
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+type claims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	ExpiresAt *int64   `json:"exp"`
+	NotBefore *int64   `json:"nbf"`
+	Scope     string   `json:"scope"`
+	Scopes    []string `json:"scopes"`
+}
+
+var algorithms = map[string]func() hash.Hash{
+	"HS256": sha256.New,
+	"HS384": sha512.New384,
+	"HS512": sha512.New,
+}
+
+var errMalformedToken = errors.New("malformed token")
+
+// verifyJWT checks the signature and registered claims of token and
+// returns the identity it carries.
+func verifyJWT(cfg *JWTConfig, token string, now time.Time) (Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Identity{}, errMalformedToken
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Identity{}, errMalformedToken
+	}
+	newHash, ok := algorithms[header.Alg]
+	if !ok {
+		return Identity{}, fmt.Errorf("unsupported token algorithm %q", header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Identity{}, errMalformedToken
+	}
+	mac := hmac.New(newHash, cfg.Secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return Identity{}, errors.New("invalid token signature")
+	}
+
+	var c claims
+	if err := decodeSegment(parts[1], &c); err != nil {
+		return Identity{}, errMalformedToken
+	}
+	if c.ExpiresAt != nil && now.After(time.Unix(*c.ExpiresAt, 0).Add(cfg.Leeway)) {
+		return Identity{}, errors.New("token expired")
+	}
+	if c.NotBefore != nil && now.Add(cfg.Leeway).Before(time.Unix(*c.NotBefore, 0)) {
+		return Identity{}, errors.New("token not valid yet")
+	}
+	if cfg.Issuer != "" && c.Issuer != cfg.Issuer {
+		return Identity{}, errors.New("invalid token issuer")
+	}
+	if cfg.Audience != "" && !contains(c.Audience, cfg.Audience) {
+		return Identity{}, errors.New("invalid token audience")
+	}
+
+	scopes := c.Scopes
+	if c.Scope != "" {
+		scopes = append(scopes, strings.Fields(c.Scope)...)
+	}
+	return Identity{Name: c.Subject, Method: "jwt", Scopes: scopes}, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
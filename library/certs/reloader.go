@@ -0,0 +1,175 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Options describes the server certificate and client verification.
+type Options struct {
+	CertFile string
+	KeyFile  string
+	// Certificate is served when CertFile is empty, e.g. a self-signed
+	// certificate generated in memory. It is never reloaded.
+	Certificate *tls.Certificate
+	// ClientCAFile enables client certificate verification against the CAs
+	// in the PEM file.
+	ClientCAFile string
+	ClientAuth   tls.ClientAuthType
+	MinVersion   uint16
+}
+
+// Reloader serves a certificate and client CA pool that are re-read from
+// disk when the files change, so rotated certificates are picked up
+// without a restart. Handshakes keep using the previous certificate if a
+// reload fails.
+type Reloader struct {
+	opts Options
+	base *tls.Config
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+	// verifying is base with the current client CA pool, replaced as a
+	// whole on reload. It is nil without a client CA file.
+	verifying atomic.Pointer[tls.Config]
+}
+
+func NewReloader(opts Options) (*Reloader, error) {
+	if opts.CertFile == "" && opts.Certificate == nil {
+		return nil, errors.New("no certificate configured")
+	}
+	r := &Reloader{opts: opts, cert: opts.Certificate}
+	r.base = &tls.Config{
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return r.Certificate(), nil
+		},
+		MinVersion: opts.MinVersion,
+		// Stay on HTTP/1.1 so websocket upgrades work on every connection.
+		NextProtos: []string{"http/1.1"},
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload re-reads the certificate, key and client CA files.
+func (r *Reloader) Reload() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+
+	cert := r.opts.Certificate
+	if r.opts.CertFile != "" {
+		c, err := tls.LoadX509KeyPair(r.opts.CertFile, r.opts.KeyFile)
+		if err != nil {
+			return fmt.Errorf("loading certificate: %v", err)
+		}
+		cert = &c
+	}
+
+	var verifying *tls.Config
+	if r.opts.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.opts.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("loading client CA: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("loading client CA: no certificates found in %s", r.opts.ClientCAFile)
+		}
+		verifying = r.base.Clone()
+		verifying.ClientCAs = pool
+		verifying.ClientAuth = r.opts.ClientAuth
+	}
+
+	r.mu.Lock()
+	r.cert, r.modTime = cert, modTime
+	r.mu.Unlock()
+	r.verifying.Store(verifying)
+	return nil
+}
+
+// latestModTime returns the most recent modification time of the
+// configured files.
+func (r *Reloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, path := range []string{r.opts.CertFile, r.opts.KeyFile, r.opts.ClientCAFile} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// Watch checks the files every interval and reloads them when one has
+// changed, until ctx is done.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			modTime, err := r.latestModTime()
+			if err != nil {
+				log.Printf("Failed to check TLS files: %v", err)
+				continue
+			}
+			r.mu.RLock()
+			changed := !modTime.Equal(r.modTime)
+			r.mu.RUnlock()
+			if !changed {
+				continue
+			}
+
+			if err := r.Reload(); err != nil {
+				log.Printf("Failed to reload TLS files, keeping the previous certificate: %v", err)
+				continue
+			}
+			log.Printf("Reloaded TLS files")
+		}
+	}
+}
+
+// Certificate returns the certificate currently served.
+func (r *Reloader) Certificate() *tls.Certificate {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert
+}
+
+// TLSConfig returns the server config. The certificate is looked up on
+// every handshake. With a client CA file, handshakes switch to a config
+// holding the current pool, which is only rebuilt on reload; session
+// ticket keys are shared with the returned config, so resumption works
+// across reloads.
+func (r *Reloader) TLSConfig() *tls.Config {
+	if r.opts.ClientCAFile == "" {
+		return r.base
+	}
+	cfg := r.base.Clone()
+	cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		return r.verifying.Load(), nil
+	}
+	return cfg
+}
@@ -0,0 +1,317 @@
+package cgroupinfo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"net/http"
+
+	pressureinfo "checker/library/pressure"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrNoHierarchy is returned when no cgroup hierarchy is mounted at the
+// root, e.g. on other operating systems.
+var ErrNoHierarchy = errors.New("no cgroup hierarchy found")
+
+// CPUStats is the CPU time used by a cgroup and how often its quota
+// throttled it.
+type CPUStats struct {
+	UsageUsec     uint64 `json:"usage_usec"`
+	UserUsec      uint64 `json:"user_usec"`
+	SystemUsec    uint64 `json:"system_usec"`
+	NrPeriods     uint64 `json:"nr_periods"`
+	NrThrottled   uint64 `json:"nr_throttled"`
+	ThrottledUsec uint64 `json:"throttled_usec"`
+	// LimitCores is the quota divided by the period, or zero when
+	// unlimited.
+	LimitCores float64 `json:"limit_cores,omitempty"`
+}
+
+// MemoryStats is the memory charged to a cgroup, in bytes. Max is nil when
+// unlimited. Events counts how often the cgroup hit its limits, using the
+// cgroup v2 names: low, high, max, oom and oom_kill.
+type MemoryStats struct {
+	Current uint64            `json:"current"`
+	Max     *uint64           `json:"max,omitempty"`
+	Events  map[string]uint64 `json:"events,omitempty"`
+}
+
+// IOStats is the IO of a cgroup on one block device, identified by its
+// major:minor numbers.
+type IOStats struct {
+	Device     string `json:"device"`
+	ReadBytes  uint64 `json:"read_bytes"`
+	WriteBytes uint64 `json:"write_bytes"`
+	ReadIOs    uint64 `json:"read_ios"`
+	WriteIOs   uint64 `json:"write_ios"`
+}
+
+// PidsStats is the number of tasks in a cgroup. Max is nil when unlimited.
+type PidsStats struct {
+	Current uint64  `json:"current"`
+	Max     *uint64 `json:"max,omitempty"`
+}
+
+// Cgroup holds the statistics of one cgroup. Controllers that are not
+// enabled for it are left nil.
+type Cgroup struct {
+	// Path is relative to the hierarchy root, e.g. "/system.slice".
+	Path        string       `json:"path"`
+	ContainerID string       `json:"container_id,omitempty"`
+	CPU         *CPUStats    `json:"cpu,omitempty"`
+	Memory      *MemoryStats `json:"memory,omitempty"`
+	IO          []IOStats    `json:"io,omitempty"`
+	Pids        *PidsStats   `json:"pids,omitempty"`
+	// Pressure is only available on the unified hierarchy.
+	Pressure *pressureinfo.Snapshot `json:"pressure,omitempty"`
+}
+
+// Snapshot is a point-in-time view of every cgroup, sorted by path.
+type Snapshot struct {
+	// Version is 2 for the unified hierarchy and 1 for the legacy
+	// per-controller hierarchies.
+	Version int      `json:"version"`
+	Cgroups []Cgroup `json:"cgroups"`
+}
+
+// Options controls where the cgroup filesystem is read from.
+type Options struct {
+	Root string
+}
+
+var DefaultOptions = Options{Root: "/sys/fs/cgroup"}
+
+// Collect reads every cgroup under the default root.
+func Collect(ctx context.Context) (Snapshot, error) {
+	return CollectWithOptions(ctx, DefaultOptions)
+}
+
+// CollectWithOptions reads every cgroup under opts.Root, preferring the
+// unified hierarchy and falling back to the legacy one.
+func CollectWithOptions(ctx context.Context, opts Options) (Snapshot, error) {
+	if _, err := os.Stat(filepath.Join(opts.Root, "cgroup.controllers")); err == nil {
+		cgroups, err := collectV2(ctx, opts.Root)
+		return Snapshot{Version: 2, Cgroups: cgroups}, err
+	}
+	for _, dirs := range v1Controllers {
+		if _, ok := findDir(opts.Root, dirs); ok {
+			cgroups, err := collectV1(ctx, opts.Root)
+			return Snapshot{Version: 1, Cgroups: cgroups}, err
+		}
+	}
+	return Snapshot{}, fmt.Errorf("%w at %s", ErrNoHierarchy, opts.Root)
+}
+
+// walk calls fn with the path of every cgroup below root, relative to it.
+func walk(ctx context.Context, root string, fn func(dir, path string)) error {
+	// WalkDir does not descend into a symlinked root, and v1 hierarchies
+	// such as cpu and cpuacct are usually links to cpu,cpuacct.
+	root, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+	return filepath.WalkDir(root, func(dir string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Cgroups can be removed while walking.
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, dir)
+		if err != nil {
+			return err
+		}
+		fn(dir, "/"+strings.TrimPrefix(filepath.ToSlash(rel), "."))
+		return nil
+	})
+}
+
+func collectV2(ctx context.Context, root string) ([]Cgroup, error) {
+	cgroups := []Cgroup{}
+	err := walk(ctx, root, func(dir, path string) {
+		cg := Cgroup{Path: path, ContainerID: ContainerID(path)}
+
+		if stat, err := readKeyValues(filepath.Join(dir, "cpu.stat")); err == nil {
+			cg.CPU = &CPUStats{
+				UsageUsec:     stat["usage_usec"],
+				UserUsec:      stat["user_usec"],
+				SystemUsec:    stat["system_usec"],
+				NrPeriods:     stat["nr_periods"],
+				NrThrottled:   stat["nr_throttled"],
+				ThrottledUsec: stat["throttled_usec"],
+			}
+			if fields, err := readFields(filepath.Join(dir, "cpu.max")); err == nil && len(fields) == 2 {
+				cg.CPU.LimitCores = limitCores(fields[0], fields[1])
+			}
+		}
+
+		if current, err := readUint(filepath.Join(dir, "memory.current")); err == nil {
+			cg.Memory = &MemoryStats{Current: current}
+			cg.Memory.Max, _ = readLimit(filepath.Join(dir, "memory.max"))
+			if events, err := readKeyValues(filepath.Join(dir, "memory.events")); err == nil {
+				cg.Memory.Events = events
+			}
+		}
+
+		if io, err := readIOStatV2(filepath.Join(dir, "io.stat")); err == nil {
+			cg.IO = io
+		}
+
+		if current, err := readUint(filepath.Join(dir, "pids.current")); err == nil {
+			cg.Pids = &PidsStats{Current: current}
+			cg.Pids.Max, _ = readLimit(filepath.Join(dir, "pids.max"))
+		}
+
+		if pressure, ok := pressureinfo.ReadCgroup(dir); ok {
+			cg.Pressure = &pressure
+		}
+
+		cgroups = append(cgroups, cg)
+	})
+	sortCgroups(cgroups)
+	return cgroups, err
+}
+
+func sortCgroups(cgroups []Cgroup) {
+	sort.Slice(cgroups, func(i, j int) bool { return cgroups[i].Path < cgroups[j].Path })
+}
+
+// readIOStatV2 parses io.stat lines like
+// "8:0 rbytes=1 wbytes=2 rios=3 wios=4 dbytes=0 dios=0".
+func readIOStatV2(path string) ([]IOStats, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var stats []IOStats
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		io := IOStats{Device: fields[0]}
+		for _, field := range fields[1:] {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+			n, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				continue
+			}
+			switch key {
+			case "rbytes":
+				io.ReadBytes = n
+			case "wbytes":
+				io.WriteBytes = n
+			case "rios":
+				io.ReadIOs = n
+			case "wios":
+				io.WriteIOs = n
+			}
+		}
+		stats = append(stats, io)
+	}
+	sortIO(stats)
+	return stats, nil
+}
+
+func sortIO(stats []IOStats) {
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Device < stats[j].Device })
+}
+
+// limitCores converts a CPU quota and period in microseconds to cores.
+func limitCores(quota, period string) float64 {
+	q, err := strconv.ParseFloat(quota, 64)
+	if err != nil || q <= 0 {
+		return 0
+	}
+	p, err := strconv.ParseFloat(period, 64)
+	if err != nil || p <= 0 {
+		return 0
+	}
+	return q / p
+}
+
+func readFields(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(data)), nil
+}
+
+func readUint(path string) (uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// readLimit reads a limit file, returning nil for "max".
+func readLimit(path string) (*uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := strings.TrimSpace(string(data))
+	if s == "max" {
+		return nil, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// readKeyValues parses files of "key value" lines, skipping values that
+// are not numbers.
+func readKeyValues(path string) (map[string]uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]uint64)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		if n, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			values[fields[0]] = n
+		}
+	}
+	return values, scanner.Err()
+}
+
+func GetCgroupInfo(c *gin.Context) {
+	snap, err := Collect(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, snap)
+}
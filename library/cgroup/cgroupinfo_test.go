@@ -0,0 +1,187 @@
+package cgroupinfo
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	pressureinfo "checker/library/pressure"
+)
+
+const testContainerID = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func uint64p(n uint64) *uint64 { return &n }
+
+func collectFixture(t *testing.T, root string) Snapshot {
+	t.Helper()
+	snap, err := CollectWithOptions(context.Background(), Options{Root: root})
+	if err != nil {
+		t.Fatalf("CollectWithOptions(%s): %v", root, err)
+	}
+	return snap
+}
+
+func findCgroup(t *testing.T, snap Snapshot, path string) Cgroup {
+	t.Helper()
+	for _, cg := range snap.Cgroups {
+		if cg.Path == path {
+			return cg
+		}
+	}
+	t.Fatalf("cgroup %s not found in %+v", path, snap.Cgroups)
+	return Cgroup{}
+}
+
+func TestCollectV2(t *testing.T) {
+	snap := collectFixture(t, "testdata/v2")
+	if snap.Version != 2 {
+		t.Errorf("Version = %d, want 2", snap.Version)
+	}
+
+	var paths []string
+	for _, cg := range snap.Cgroups {
+		paths = append(paths, cg.Path)
+	}
+	wantPaths := []string{"/", "/system.slice", "/system.slice/docker-" + testContainerID + ".scope", "/user.slice"}
+	if !reflect.DeepEqual(paths, wantPaths) {
+		t.Errorf("paths = %q, want %q", paths, wantPaths)
+	}
+
+	root := findCgroup(t, snap, "/")
+	if root.CPU == nil || root.CPU.UsageUsec != 9000000 {
+		t.Errorf("root CPU = %+v, want usage 9000000", root.CPU)
+	}
+	if root.Pressure == nil || root.Pressure.Memory == nil || root.Pressure.Memory.Some.Total != 123456 {
+		t.Errorf("root memory pressure = %+v", root.Pressure)
+	}
+
+	slice := findCgroup(t, snap, "/system.slice")
+	if slice.CPU.LimitCores != 0 {
+		t.Errorf("unlimited cpu.max: LimitCores = %v, want 0", slice.CPU.LimitCores)
+	}
+	if slice.Memory == nil || slice.Memory.Max != nil {
+		t.Errorf("memory.max of max: Memory = %+v, want no Max", slice.Memory)
+	}
+	if slice.ContainerID != "" {
+		t.Errorf("ContainerID = %q, want none", slice.ContainerID)
+	}
+
+	got := findCgroup(t, snap, "/system.slice/docker-"+testContainerID+".scope")
+	want := Cgroup{
+		Path:        "/system.slice/docker-" + testContainerID + ".scope",
+		ContainerID: testContainerID,
+		CPU: &CPUStats{
+			UsageUsec: 2000000, UserUsec: 1500000, SystemUsec: 500000,
+			NrPeriods: 50, NrThrottled: 5, ThrottledUsec: 100000,
+			LimitCores: 1.5,
+		},
+		Memory: &MemoryStats{
+			Current: 52428800,
+			Max:     uint64p(67108864),
+			Events:  map[string]uint64{"low": 0, "high": 0, "max": 7, "oom": 2, "oom_kill": 1},
+		},
+		IO: []IOStats{
+			{Device: "8:0", ReadBytes: 1048576, WriteBytes: 2097152, ReadIOs: 10, WriteIOs: 20},
+			{Device: "8:16", ReadBytes: 4096, WriteBytes: 8192, ReadIOs: 1, WriteIOs: 2},
+		},
+		Pids: &PidsStats{Current: 3, Max: uint64p(100)},
+		Pressure: &pressureinfo.Snapshot{
+			CPU: &pressureinfo.Resource{
+				Some: &pressureinfo.Averages{Avg10: 0.1, Avg60: 0.2, Avg300: 0.3, Total: 1000},
+				Full: &pressureinfo.Averages{Avg10: 0.05, Avg60: 0.1, Avg300: 0.15, Total: 500},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("container cgroup =\n%+v\nwant\n%+v", got, want)
+	}
+
+	user := findCgroup(t, snap, "/user.slice")
+	if user.Pids == nil || user.Pids.Current != 7 || user.Pids.Max != nil {
+		t.Errorf("user.slice Pids = %+v, want 7 of unlimited", user.Pids)
+	}
+	if user.CPU != nil || user.IO != nil || user.Pressure != nil {
+		t.Errorf("user.slice has stats of disabled controllers: %+v", user)
+	}
+}
+
+// The v1 fixture mounts cpu and cpuacct as links to cpu,cpuacct, as most
+// distributions do.
+func TestCollectV1(t *testing.T) {
+	snap := collectFixture(t, "testdata/v1")
+	if snap.Version != 1 {
+		t.Errorf("Version = %d, want 1", snap.Version)
+	}
+
+	root := findCgroup(t, snap, "/")
+	if root.CPU == nil || root.CPU.UsageUsec != 9000000 {
+		t.Errorf("root CPU = %+v, want usage 9000000", root.CPU)
+	}
+	if root.Memory == nil || root.Memory.Current != 2147483648 || root.Memory.Max != nil {
+		t.Errorf("root Memory = %+v, want 2147483648 of unlimited", root.Memory)
+	}
+
+	got := findCgroup(t, snap, "/docker/"+testContainerID)
+	want := Cgroup{
+		Path:        "/docker/" + testContainerID,
+		ContainerID: testContainerID,
+		CPU: &CPUStats{
+			UsageUsec: 2000000, UserUsec: 1500000, SystemUsec: 500000,
+			NrPeriods: 50, NrThrottled: 5, ThrottledUsec: 100000,
+			LimitCores: 0.5,
+		},
+		Memory: &MemoryStats{
+			Current: 52428800,
+			Max:     uint64p(67108864),
+			Events:  map[string]uint64{"max": 7, "oom_kill": 1},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("container cgroup =\n%+v\nwant\n%+v", got, want)
+	}
+
+	docker := findCgroup(t, snap, "/docker")
+	wantIO := []IOStats{{Device: "8:0", ReadBytes: 1048576, WriteBytes: 2097152, ReadIOs: 10, WriteIOs: 20}}
+	if !reflect.DeepEqual(docker.IO, wantIO) {
+		t.Errorf("/docker IO = %+v, want %+v", docker.IO, wantIO)
+	}
+	if docker.Pids == nil || docker.Pids.Current != 4 || docker.Pids.Max != nil {
+		t.Errorf("/docker Pids = %+v, want 4 of unlimited", docker.Pids)
+	}
+}
+
+func TestCollectNoHierarchy(t *testing.T) {
+	_, err := CollectWithOptions(context.Background(), Options{Root: t.TempDir()})
+	if !errors.Is(err, ErrNoHierarchy) {
+		t.Errorf("err = %v, want ErrNoHierarchy", err)
+	}
+}
+
+func TestContainerID(t *testing.T) {
+	for path, want := range map[string]string{
+		"/system.slice/docker-" + testContainerID + ".scope":                               testContainerID,
+		"/kubepods.slice/kubepods-pod1.slice/cri-containerd-" + testContainerID + ".scope": testContainerID,
+		"/docker/" + testContainerID:                                                       testContainerID,
+		"/system.slice/sshd.service":                                                       "",
+		"/user.slice/user-1000.slice/session-" + testContainerID[:10] + ".scope":           "",
+	} {
+		if got := ContainerID(path); got != want {
+			t.Errorf("ContainerID(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestParseProcessCgroup(t *testing.T) {
+	for _, tt := range []struct {
+		name, data, want string
+	}{
+		{"unified", "0::/system.slice/sshd.service\n", "/system.slice/sshd.service"},
+		{"hybrid prefers memory", "12:cpu,cpuacct:/docker/a\n5:memory:/docker/b\n0::/\n", "/docker/b"},
+		{"legacy without memory", "1:name=systemd:/init.scope\n3:pids:/user.slice\n", "/user.slice"},
+	} {
+		if got := ParseProcessCgroup(tt.data); got != tt.want {
+			t.Errorf("%s: ParseProcessCgroup = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package cgroupinfo
+
+import (
+	"os"
+	"regexp"
+	"strings"
+)
+
+// containerIDPattern matches the 64 hex digit ID that Docker, containerd,
+// CRI-O and Podman put in the last element of a container's cgroup path,
+// e.g. "docker-<id>.scope", "cri-containerd-<id>.scope" or "/docker/<id>".
+var containerIDPattern = regexp.MustCompile(`(?:^|[-:])([0-9a-f]{64})(?:\.scope)?$`)
+
+// ContainerID returns the ID of the container a cgroup path belongs to, or
+// "" if it does not look like a container cgroup.
+func ContainerID(path string) string {
+	base := path[strings.LastIndex(path, "/")+1:]
+	if m := containerIDPattern.FindStringSubmatch(base); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// ParseProcessCgroup returns the cgroup path of a process from the contents
+// of its /proc/<pid>/cgroup file. The memory hierarchy is preferred when
+// legacy controllers are mounted, as on hybrid hosts the unified hierarchy
+// holds no controllers; otherwise it is the unified "0::" entry.
+func ParseProcessCgroup(data string) string {
+	var unified, fallback string
+	for _, line := range strings.Split(data, "\n") {
+		// Lines are "hierarchy-ID:controller-list:path".
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[0] == "0" && parts[1] == "" {
+			unified = parts[2]
+			continue
+		}
+		for _, controller := range strings.Split(parts[1], ",") {
+			if controller == "memory" {
+				return parts[2]
+			}
+		}
+		if fallback == "" && parts[1] != "" && !strings.HasPrefix(parts[1], "name=") {
+			fallback = parts[2]
+		}
+	}
+	if fallback != "" {
+		return fallback
+	}
+	return unified
+}
+
+// ReadProcessCgroup reads the cgroup path of a process from a
+// /proc/<pid>/cgroup file.
+func ReadProcessCgroup(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return ParseProcessCgroup(string(data)), nil
+}
@@ -0,0 +1,199 @@
+package cgroupinfo
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// v1Controllers lists the directories each legacy controller may be
+// mounted at, as co-mounted controllers share one.
+var v1Controllers = map[string][]string{
+	"cpu":     {"cpu", "cpu,cpuacct", "cpuacct,cpu"},
+	"cpuacct": {"cpuacct", "cpu,cpuacct", "cpuacct,cpu"},
+	"memory":  {"memory"},
+	"blkio":   {"blkio"},
+	"pids":    {"pids"},
+}
+
+// userHZ is the unit of cpuacct.stat, fixed at 100 by the kernel ABI.
+const userHZ = 100
+
+// unlimitedV1 is the smallest value treated as no limit; the kernel
+// reports unlimited memory as the largest page-aligned int64.
+const unlimitedV1 = 1 << 62
+
+func findDir(root string, dirs []string) (string, bool) {
+	for _, dir := range dirs {
+		path := filepath.Join(root, dir)
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// collectV1 merges the per-controller hierarchies into one list by cgroup
+// path.
+func collectV1(ctx context.Context, root string) ([]Cgroup, error) {
+	cgroups := make(map[string]*Cgroup)
+	get := func(path string) *Cgroup {
+		cg, ok := cgroups[path]
+		if !ok {
+			cg = &Cgroup{Path: path, ContainerID: ContainerID(path)}
+			cgroups[path] = cg
+		}
+		return cg
+	}
+	cpu := func(cg *Cgroup) *CPUStats {
+		if cg.CPU == nil {
+			cg.CPU = &CPUStats{}
+		}
+		return cg.CPU
+	}
+
+	readers := map[string]func(dir string, cg *Cgroup){
+		"cpuacct": func(dir string, cg *Cgroup) {
+			if usage, err := readUint(filepath.Join(dir, "cpuacct.usage")); err == nil {
+				cpu(cg).UsageUsec = usage / 1000
+			}
+			if stat, err := readKeyValues(filepath.Join(dir, "cpuacct.stat")); err == nil {
+				c := cpu(cg)
+				c.UserUsec = stat["user"] * 1e6 / userHZ
+				c.SystemUsec = stat["system"] * 1e6 / userHZ
+			}
+		},
+		"cpu": func(dir string, cg *Cgroup) {
+			if stat, err := readKeyValues(filepath.Join(dir, "cpu.stat")); err == nil {
+				c := cpu(cg)
+				c.NrPeriods = stat["nr_periods"]
+				c.NrThrottled = stat["nr_throttled"]
+				c.ThrottledUsec = stat["throttled_time"] / 1000
+			}
+			quota, err := os.ReadFile(filepath.Join(dir, "cpu.cfs_quota_us"))
+			if err != nil {
+				return
+			}
+			period, err := os.ReadFile(filepath.Join(dir, "cpu.cfs_period_us"))
+			if err != nil {
+				return
+			}
+			if limit := limitCores(strings.TrimSpace(string(quota)), strings.TrimSpace(string(period))); limit > 0 {
+				cpu(cg).LimitCores = limit
+			}
+		},
+		"memory": func(dir string, cg *Cgroup) {
+			usage, err := readUint(filepath.Join(dir, "memory.usage_in_bytes"))
+			if err != nil {
+				return
+			}
+			cg.Memory = &MemoryStats{Current: usage, Events: make(map[string]uint64)}
+			if limit, err := readUint(filepath.Join(dir, "memory.limit_in_bytes")); err == nil && limit < unlimitedV1 {
+				cg.Memory.Max = &limit
+			}
+			// The closest v1 equivalents of the v2 max and oom_kill events.
+			if failcnt, err := readUint(filepath.Join(dir, "memory.failcnt")); err == nil {
+				cg.Memory.Events["max"] = failcnt
+			}
+			if oom, err := readKeyValues(filepath.Join(dir, "memory.oom_control")); err == nil {
+				if kills, ok := oom["oom_kill"]; ok {
+					cg.Memory.Events["oom_kill"] = kills
+				}
+			}
+		},
+		"blkio": func(dir string, cg *Cgroup) {
+			if io, err := readIOStatV1(dir); err == nil && len(io) > 0 {
+				cg.IO = io
+			}
+		},
+		"pids": func(dir string, cg *Cgroup) {
+			current, err := readUint(filepath.Join(dir, "pids.current"))
+			if err != nil {
+				return
+			}
+			cg.Pids = &PidsStats{Current: current}
+			cg.Pids.Max, _ = readLimit(filepath.Join(dir, "pids.max"))
+		},
+	}
+
+	for controller, read := range readers {
+		base, ok := findDir(root, v1Controllers[controller])
+		if !ok {
+			continue
+		}
+		err := walk(ctx, base, func(dir, path string) {
+			read(dir, get(path))
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	list := make([]Cgroup, 0, len(cgroups))
+	for _, cg := range cgroups {
+		list = append(list, *cg)
+	}
+	sortCgroups(list)
+	return list, nil
+}
+
+// readIOStatV1 combines blkio.throttle.io_service_bytes and
+// blkio.throttle.io_serviced, whose lines look like "8:0 Read 4096".
+func readIOStatV1(dir string) ([]IOStats, error) {
+	devices := make(map[string]*IOStats)
+	read := func(name string, set func(io *IOStats, op string, n uint64)) error {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) != 3 {
+				continue
+			}
+			n, err := strconv.ParseUint(fields[2], 10, 64)
+			if err != nil {
+				continue
+			}
+			io, ok := devices[fields[0]]
+			if !ok {
+				io = &IOStats{Device: fields[0]}
+				devices[fields[0]] = io
+			}
+			set(io, fields[1], n)
+		}
+		return nil
+	}
+
+	err := read("blkio.throttle.io_service_bytes", func(io *IOStats, op string, n uint64) {
+		switch op {
+		case "Read":
+			io.ReadBytes = n
+		case "Write":
+			io.WriteBytes = n
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = read("blkio.throttle.io_serviced", func(io *IOStats, op string, n uint64) {
+		switch op {
+		case "Read":
+			io.ReadIOs = n
+		case "Write":
+			io.WriteIOs = n
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make([]IOStats, 0, len(devices))
+	for _, io := range devices {
+		stats = append(stats, *io)
+	}
+	sortIO(stats)
+	return stats, nil
+}
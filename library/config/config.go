@@ -0,0 +1,540 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Duration is a time.Duration written as a string such as "5s" in YAML
+// and TOML files.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+type TLSConfig struct {
+	CertFile string `yaml:"cert_file" toml:"cert_file"`
+	KeyFile  string `yaml:"key_file" toml:"key_file"`
+	// ClientCAFile enables mutual TLS: clients must present a certificate
+	// signed by one of the CAs in this PEM file.
+	ClientCAFile string `yaml:"client_ca_file" toml:"client_ca_file"`
+	// ClientAuth is "require" (the default) or "optional", which verifies a
+	// client certificate only when one is presented.
+	ClientAuth string `yaml:"client_auth" toml:"client_auth"`
+	// SelfSigned generates a certificate for Hosts at startup. With
+	// cert_file and key_file set it is written there once and reused.
+	SelfSigned bool     `yaml:"self_signed" toml:"self_signed"`
+	Hosts      []string `yaml:"hosts" toml:"hosts"`
+	// MinVersion is "1.2" or "1.3".
+	MinVersion string `yaml:"min_version" toml:"min_version"`
+	// ReloadInterval is how often the certificate files are checked for
+	// rotation; 0 disables reloading.
+	ReloadInterval Duration `yaml:"reload_interval" toml:"reload_interval"`
+}
+
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != "" || t.SelfSigned
+}
+
+type CORSConfig struct {
+	// AllowOrigins lists allowed origins; "*" allows any origin.
+	AllowOrigins     []string `yaml:"allow_origins" toml:"allow_origins"`
+	AllowCredentials bool     `yaml:"allow_credentials" toml:"allow_credentials"`
+}
+
+// CollectorConfig tunes one collector. PerProcessTimeout and AllowEnviron
+// only apply to the process collector, Polls only to the gpu collector,
+// Partitions only to the disk collector and MetricDepth only to the cgroup
+// collector.
+type CollectorConfig struct {
+	Enabled           *bool    `yaml:"enabled" toml:"enabled"`
+	Interval          Duration `yaml:"interval" toml:"interval"`
+	Timeout           Duration `yaml:"timeout" toml:"timeout"`
+	PerProcessTimeout Duration `yaml:"per_process_timeout" toml:"per_process_timeout"`
+	Polls             int      `yaml:"polls" toml:"polls"`
+	// AllowEnviron lets process detail requests include the environment
+	// with env=true. It is off by default as environments hold secrets.
+	AllowEnviron bool `yaml:"allow_environ" toml:"allow_environ"`
+	// Root is where collectors reading a pseudo filesystem find it, e.g.
+	// a fixture directory instead of /sys/fs/cgroup.
+	Root string `yaml:"root" toml:"root"`
+	// Partitions selects the partitions the disk collector reports.
+	Partitions *PartitionFilter `yaml:"partitions" toml:"partitions"`
+	// MetricDepth is the deepest cgroup below the root recorded in history
+	// and evaluated by alert rules. Container cgroups are at any depth.
+	MetricDepth *int `yaml:"metric_depth" toml:"metric_depth"`
+}
+
+// PartitionFilter lists fstypes, and glob patterns of mountpoints and
+// devices, to include or exclude. Lists left unset keep their defaults,
+// which exclude virtual filesystems; an empty list clears them.
+type PartitionFilter struct {
+	IncludeFstypes     []string `yaml:"include_fstypes" toml:"include_fstypes"`
+	ExcludeFstypes     []string `yaml:"exclude_fstypes" toml:"exclude_fstypes"`
+	IncludeMountpoints []string `yaml:"include_mountpoints" toml:"include_mountpoints"`
+	ExcludeMountpoints []string `yaml:"exclude_mountpoints" toml:"exclude_mountpoints"`
+	IncludeDevices     []string `yaml:"include_devices" toml:"include_devices"`
+	ExcludeDevices     []string `yaml:"exclude_devices" toml:"exclude_devices"`
+}
+
+func (c CollectorConfig) IsEnabled() bool {
+	return c.Enabled == nil || *c.Enabled
+}
+
+type HistoryConfig struct {
+	// Tiers is a list of resolution:retention pairs, e.g. "10s:1h,1m:24h".
+	Tiers string `yaml:"tiers" toml:"tiers"`
+	// MaxSeries bounds the number of series kept. Points of new series
+	// are dropped while it is reached.
+	MaxSeries int `yaml:"max_series" toml:"max_series"`
+}
+
+type AlertsConfig struct {
+	RulesFile string `yaml:"rules_file" toml:"rules_file"`
+	// NotifyFile is the YAML file configuring notification receivers.
+	NotifyFile string `yaml:"notify_file" toml:"notify_file"`
+}
+
+// APIKeyConfig is a static API key. The key can be read from the
+// environment variable named by KeyEnv instead of being written inline.
+type APIKeyConfig struct {
+	Name   string   `yaml:"name" toml:"name"`
+	Key    string   `yaml:"key" toml:"key"`
+	KeyEnv string   `yaml:"key_env" toml:"key_env"`
+	Scopes []string `yaml:"scopes" toml:"scopes"`
+}
+
+// JWTConfig verifies HMAC-signed bearer tokens.
+type JWTConfig struct {
+	Secret    string   `yaml:"secret" toml:"secret"`
+	SecretEnv string   `yaml:"secret_env" toml:"secret_env"`
+	Issuer    string   `yaml:"issuer" toml:"issuer"`
+	Audience  string   `yaml:"audience" toml:"audience"`
+	Leeway    Duration `yaml:"leeway" toml:"leeway"`
+}
+
+// AuthConfig protects the API. Without API keys, a JWT secret or client
+// certificate scopes the API is open.
+type AuthConfig struct {
+	APIKeys []APIKeyConfig `yaml:"api_keys" toml:"api_keys"`
+	JWT     *JWTConfig     `yaml:"jwt" toml:"jwt"`
+	// ClientCertScopes are granted to clients presenting a certificate
+	// verified against tls.client_ca_file.
+	ClientCertScopes []string `yaml:"client_cert_scopes" toml:"client_cert_scopes"`
+}
+
+func (a AuthConfig) Enabled() bool {
+	return len(a.APIKeys) > 0 || a.JWT != nil || len(a.ClientCertScopes) > 0
+}
+
+// WebhookConfig is a JSON webhook. With a secret, requests are signed
+// like alert notification webhooks.
+type WebhookConfig struct {
+	URL     string            `yaml:"url" toml:"url"`
+	Secret  string            `yaml:"secret" toml:"secret"`
+	Headers map[string]string `yaml:"headers" toml:"headers"`
+	Timeout Duration          `yaml:"timeout" toml:"timeout"`
+}
+
+// ProcessEventsConfig configures where process start and exit events are
+// sent besides the websocket.
+type ProcessEventsConfig struct {
+	Webhooks []WebhookConfig `yaml:"webhooks" toml:"webhooks"`
+}
+
+// WatchConfig watches the processes matching every criterion given.
+type WatchConfig struct {
+	Name         string `yaml:"name" toml:"name"`
+	Exe          string `yaml:"exe" toml:"exe"`
+	Cmdline      string `yaml:"cmdline" toml:"cmdline"`
+	Pidfile      string `yaml:"pidfile" toml:"pidfile"`
+	MinInstances int    `yaml:"min_instances" toml:"min_instances"`
+}
+
+// Scopes that can be granted to API keys and tokens.
+var scopes = map[string]bool{"metrics": true, "stream": true, "history": true, "alerts": true, "*": true}
+
+type Config struct {
+	Listen        string                     `yaml:"listen" toml:"listen"`
+	TLS           TLSConfig                  `yaml:"tls" toml:"tls"`
+	CORS          CORSConfig                 `yaml:"cors" toml:"cors"`
+	Auth          AuthConfig                 `yaml:"auth" toml:"auth"`
+	ProcessEvents ProcessEventsConfig        `yaml:"process_events" toml:"process_events"`
+	Watches       []WatchConfig              `yaml:"watches" toml:"watches"`
+	Collectors    map[string]CollectorConfig `yaml:"collectors" toml:"collectors"`
+	History       HistoryConfig              `yaml:"history" toml:"history"`
+	Alerts        AlertsConfig               `yaml:"alerts" toml:"alerts"`
+}
+
+// Default returns the built-in configuration.
+func Default() Config {
+	collector := func(interval, timeout time.Duration) CollectorConfig {
+		return CollectorConfig{Interval: Duration(interval), Timeout: Duration(timeout)}
+	}
+
+	process := collector(5*time.Second, 10*time.Second)
+	process.PerProcessTimeout = Duration(500 * time.Millisecond)
+	gpu := collector(10*time.Second, 10*time.Second)
+	gpu.Polls = 5
+	cpu := collector(time.Second, time.Second)
+	cpu.Root = "/sys/devices/system/cpu"
+	cgroup := collector(5*time.Second, 5*time.Second)
+	cgroup.Root = "/sys/fs/cgroup"
+	cgroupDepth := 1
+	cgroup.MetricDepth = &cgroupDepth
+	pressure := collector(2*time.Second, time.Second)
+	pressure.Root = "/proc/pressure"
+
+	return Config{
+		Listen: ":33551",
+		TLS: TLSConfig{
+			MinVersion:     "1.2",
+			ReloadInterval: Duration(time.Minute),
+		},
+		CORS: CORSConfig{
+			AllowOrigins: []string{"*"},
+		},
+		Collectors: map[string]CollectorConfig{
+			"system":   collector(30*time.Second, 5*time.Second),
+			"cpu":      cpu,
+			"memory":   collector(time.Second, time.Second),
+			"disk":     collector(5*time.Second, 5*time.Second),
+			"diskio":   collector(2*time.Second, 2*time.Second),
+			"network":  collector(2*time.Second, 2*time.Second),
+			"process":  process,
+			"sensors":  collector(5*time.Second, 3*time.Second),
+			"gpu":      gpu,
+			"cgroup":   cgroup,
+			"pressure": pressure,
+		},
+		History: HistoryConfig{Tiers: "10s:1h,1m:24h", MaxSeries: 10000},
+	}
+}
+
+// ReadFile merges the YAML or TOML file at path into cfg. Collectors only
+// override the fields they set.
+func (cfg *Config) ReadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	defaults := cfg.Collectors
+	cfg.Collectors = nil
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	case ".toml":
+		err = toml.Unmarshal(data, cfg)
+	default:
+		return fmt.Errorf("%s: unsupported config format %q, use .yaml, .yml or .toml", path, ext)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	for name, c := range cfg.Collectors {
+		d, ok := defaults[name]
+		if !ok {
+			// Unknown names are reported by Validate.
+			defaults[name] = c
+			continue
+		}
+		if c.Enabled != nil {
+			d.Enabled = c.Enabled
+		}
+		if c.Interval != 0 {
+			d.Interval = c.Interval
+		}
+		if c.Timeout != 0 {
+			d.Timeout = c.Timeout
+		}
+		if c.PerProcessTimeout != 0 {
+			d.PerProcessTimeout = c.PerProcessTimeout
+		}
+		if c.Polls != 0 {
+			d.Polls = c.Polls
+		}
+		if c.AllowEnviron {
+			d.AllowEnviron = true
+		}
+		if c.Root != "" {
+			d.Root = c.Root
+		}
+		if c.Partitions != nil {
+			d.Partitions = c.Partitions
+		}
+		if c.MetricDepth != nil {
+			d.MetricDepth = c.MetricDepth
+		}
+		defaults[name] = d
+	}
+	cfg.Collectors = defaults
+	return nil
+}
+
+// Validate reports every problem with cfg at once.
+func (cfg *Config) Validate() error {
+	var errs []error
+	known := Default().Collectors
+
+	if _, _, err := net.SplitHostPort(cfg.Listen); err != nil {
+		errs = append(errs, fmt.Errorf("listen: invalid address %q: %v", cfg.Listen, err))
+	}
+
+	errs = append(errs, cfg.TLS.validate()...)
+
+	for _, origin := range cfg.CORS.AllowOrigins {
+		if origin == "*" {
+			continue
+		}
+		if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("cors.allow_origins: %q is not an origin like https://example.com", origin))
+		}
+	}
+
+	if cfg.CORS.AllowCredentials {
+		for _, origin := range cfg.CORS.AllowOrigins {
+			if origin == "*" {
+				errs = append(errs, errors.New("cors: allow_credentials cannot be combined with the * origin, list the allowed origins"))
+				break
+			}
+		}
+	}
+
+	errs = append(errs, cfg.Auth.validate()...)
+	if len(cfg.Auth.ClientCertScopes) > 0 && cfg.TLS.ClientCAFile == "" {
+		errs = append(errs, errors.New("auth.client_cert_scopes: requires tls.client_ca_file"))
+	}
+
+	names := make([]string, 0, len(cfg.Collectors))
+	for name := range cfg.Collectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		c := cfg.Collectors[name]
+		if _, ok := known[name]; !ok {
+			errs = append(errs, fmt.Errorf("collectors.%s: unknown collector", name))
+			continue
+		}
+		if c.Interval <= 0 {
+			errs = append(errs, fmt.Errorf("collectors.%s.interval: must be positive", name))
+		}
+		if c.Timeout < 0 {
+			errs = append(errs, fmt.Errorf("collectors.%s.timeout: must not be negative", name))
+		}
+		if c.PerProcessTimeout != 0 && name != "process" {
+			errs = append(errs, fmt.Errorf("collectors.%s.per_process_timeout: only valid for the process collector", name))
+		}
+		if c.AllowEnviron && name != "process" {
+			errs = append(errs, fmt.Errorf("collectors.%s.allow_environ: only valid for the process collector", name))
+		}
+		if c.PerProcessTimeout < 0 {
+			errs = append(errs, fmt.Errorf("collectors.%s.per_process_timeout: must not be negative", name))
+		}
+		if c.Polls != 0 && name != "gpu" {
+			errs = append(errs, fmt.Errorf("collectors.%s.polls: only valid for the gpu collector", name))
+		}
+		if c.Polls < 0 {
+			errs = append(errs, fmt.Errorf("collectors.%s.polls: must not be negative", name))
+		}
+		if c.Root != "" && known[name].Root == "" {
+			errs = append(errs, fmt.Errorf("collectors.%s.root: not configurable for this collector", name))
+		}
+		if c.MetricDepth != nil {
+			if name != "cgroup" {
+				errs = append(errs, fmt.Errorf("collectors.%s.metric_depth: only valid for the cgroup collector", name))
+			}
+			if *c.MetricDepth < 0 {
+				errs = append(errs, fmt.Errorf("collectors.%s.metric_depth: must not be negative", name))
+			}
+		}
+		if c.Partitions != nil {
+			if name != "disk" {
+				errs = append(errs, fmt.Errorf("collectors.%s.partitions: only valid for the disk collector", name))
+			}
+			errs = append(errs, c.Partitions.validate(name)...)
+		}
+	}
+
+	if cfg.History.MaxSeries <= 0 {
+		errs = append(errs, errors.New("history.max_series: must be positive"))
+	}
+
+	for i, hook := range cfg.ProcessEvents.Webhooks {
+		if u, err := url.Parse(hook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("process_events.webhooks[%d].url: %q is not an http(s) URL", i, hook.URL))
+		}
+		if hook.Timeout < 0 {
+			errs = append(errs, fmt.Errorf("process_events.webhooks[%d].timeout: must not be negative", i))
+		}
+	}
+	if len(cfg.ProcessEvents.Webhooks) > 0 && !cfg.Collectors["process"].IsEnabled() {
+		errs = append(errs, errors.New("process_events: requires the process collector"))
+	}
+
+	watchNames := make(map[string]bool)
+	for i, w := range cfg.Watches {
+		if w.Name == "" {
+			errs = append(errs, fmt.Errorf("watches[%d].name: is required", i))
+		} else if watchNames[w.Name] {
+			errs = append(errs, fmt.Errorf("watches[%d].name: duplicate name %s", i, w.Name))
+		}
+		watchNames[w.Name] = true
+		if w.Exe == "" && w.Cmdline == "" && w.Pidfile == "" {
+			errs = append(errs, fmt.Errorf("watches[%d]: needs exe, cmdline or pidfile", i))
+		}
+		if w.Cmdline != "" {
+			if _, err := regexp.Compile(w.Cmdline); err != nil {
+				errs = append(errs, fmt.Errorf("watches[%d].cmdline: %v", i, err))
+			}
+		}
+		if w.MinInstances < 0 {
+			errs = append(errs, fmt.Errorf("watches[%d].min_instances: must not be negative", i))
+		}
+	}
+	if len(cfg.Watches) > 0 && !cfg.Collectors["process"].IsEnabled() {
+		errs = append(errs, errors.New("watches: requires the process collector"))
+	}
+
+	errs = append(errs, checkFile("alerts.rules_file", cfg.Alerts.RulesFile), checkFile("alerts.notify_file", cfg.Alerts.NotifyFile))
+	return errors.Join(errs...)
+}
+
+func checkFile(field, path string) error {
+	if path == "" {
+		return nil
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("%s: %v", field, err)
+	}
+	return nil
+}
+
+// validate checks the glob patterns of the collector called name.
+func (f *PartitionFilter) validate(name string) []error {
+	var errs []error
+	for field, patterns := range map[string][]string{
+		"include_mountpoints": f.IncludeMountpoints,
+		"exclude_mountpoints": f.ExcludeMountpoints,
+		"include_devices":     f.IncludeDevices,
+		"exclude_devices":     f.ExcludeDevices,
+	} {
+		for _, pattern := range patterns {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				errs = append(errs, fmt.Errorf("collectors.%s.partitions.%s: invalid pattern %q", name, field, pattern))
+			}
+		}
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return errs
+}
+
+func (t TLSConfig) validate() []error {
+	var errs []error
+	if !t.Enabled() {
+		if t.ClientCAFile != "" {
+			errs = append(errs, errors.New("tls.client_ca_file: requires cert_file and key_file or self_signed"))
+		}
+		return errs
+	}
+
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		errs = append(errs, errors.New("tls: cert_file and key_file must be set together"))
+	}
+	// Missing files are generated in self-signed mode.
+	if !t.SelfSigned {
+		errs = append(errs, checkFile("tls.cert_file", t.CertFile), checkFile("tls.key_file", t.KeyFile))
+	}
+	errs = append(errs, checkFile("tls.client_ca_file", t.ClientCAFile))
+
+	switch t.ClientAuth {
+	case "", "require", "optional":
+	default:
+		errs = append(errs, fmt.Errorf("tls.client_auth: must be require or optional, not %q", t.ClientAuth))
+	}
+	switch t.MinVersion {
+	case "", "1.2", "1.3":
+	default:
+		errs = append(errs, fmt.Errorf("tls.min_version: must be 1.2 or 1.3, not %q", t.MinVersion))
+	}
+	if t.ReloadInterval < 0 {
+		errs = append(errs, errors.New("tls.reload_interval: must not be negative"))
+	}
+	return errs
+}
+
+func (a *AuthConfig) validate() []error {
+	var errs []error
+	names := make(map[string]bool)
+	for i := range a.APIKeys {
+		k := &a.APIKeys[i]
+		if k.Name == "" {
+			errs = append(errs, fmt.Errorf("auth.api_keys[%d]: name is required", i))
+		} else if names[k.Name] {
+			errs = append(errs, fmt.Errorf("auth.api_keys: duplicate name %s", k.Name))
+		}
+		names[k.Name] = true
+
+		if k.KeyEnv != "" {
+			k.Key = os.Getenv(k.KeyEnv)
+		}
+		if len(k.Key) < 16 {
+			errs = append(errs, fmt.Errorf("auth.api_keys[%d]: key must be at least 16 characters", i))
+		}
+		if len(k.Scopes) == 0 {
+			errs = append(errs, fmt.Errorf("auth.api_keys[%d]: at least one scope is required", i))
+		}
+		for _, scope := range k.Scopes {
+			if !scopes[scope] {
+				errs = append(errs, fmt.Errorf("auth.api_keys[%d]: unknown scope %q", i, scope))
+			}
+		}
+	}
+
+	for _, scope := range a.ClientCertScopes {
+		if !scopes[scope] {
+			errs = append(errs, fmt.Errorf("auth.client_cert_scopes: unknown scope %q", scope))
+		}
+	}
+
+	if a.JWT != nil {
+		if a.JWT.SecretEnv != "" {
+			a.JWT.Secret = os.Getenv(a.JWT.SecretEnv)
+		}
+		if len(a.JWT.Secret) < 32 {
+			errs = append(errs, errors.New("auth.jwt.secret: must be at least 32 bytes"))
+		}
+		if a.JWT.Leeway < 0 {
+			errs = append(errs, errors.New("auth.jwt.leeway: must not be negative"))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,218 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Load builds the configuration from, in increasing precedence: the
+// defaults, the config file (-config or CONFIG_FILE), environment
+// variables and command-line flags.
+func Load(args []string) (Config, error) {
+	cfg := Default()
+
+	fs := flag.NewFlagSet("checker", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML or TOML config file")
+	listen := fs.String("listen", "", "listen address, e.g. :33551")
+	tlsCert := fs.String("tls-cert", "", "TLS certificate file")
+	tlsKey := fs.String("tls-key", "", "TLS private key file")
+	tlsClientCA := fs.String("tls-client-ca", "", "CA file for verifying client certificates (mutual TLS)")
+	tlsSelfSigned := fs.Bool("tls-self-signed", false, "serve HTTPS with a generated self-signed certificate")
+	corsOrigins := fs.String("cors-origins", "", "comma-separated allowed CORS origins, * for any")
+	collectors := fs.String("collectors", "", "comma-separated collectors to enable; all others are disabled")
+	intervals := fs.String("intervals", "", "comma-separated per-collector intervals, e.g. cpu=2s,disk=10s")
+	historyTiers := fs.String("history-tiers", "", "history tiers, e.g. 10s:1h,1m:24h")
+	alertRules := fs.String("alert-rules", "", "alert rule file")
+	notifyFile := fs.String("notify-config", "", "alert notification config file")
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	if *configFile != "" {
+		if err := cfg.ReadFile(*configFile); err != nil {
+			return Config{}, err
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return Config{}, err
+	}
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	if set["listen"] {
+		cfg.Listen = *listen
+	}
+	if set["tls-cert"] {
+		cfg.TLS.CertFile = *tlsCert
+	}
+	if set["tls-key"] {
+		cfg.TLS.KeyFile = *tlsKey
+	}
+	if set["tls-client-ca"] {
+		cfg.TLS.ClientCAFile = *tlsClientCA
+	}
+	if set["tls-self-signed"] {
+		cfg.TLS.SelfSigned = *tlsSelfSigned
+	}
+	if set["cors-origins"] {
+		cfg.CORS.AllowOrigins = splitList(*corsOrigins)
+	}
+	if set["collectors"] {
+		cfg.enableOnly(splitList(*collectors))
+	}
+	if set["intervals"] {
+		if err := cfg.setIntervals(*intervals); err != nil {
+			return Config{}, fmt.Errorf("-intervals: %v", err)
+		}
+	}
+	if set["history-tiers"] {
+		cfg.History.Tiers = *historyTiers
+	}
+	if set["alert-rules"] {
+		cfg.Alerts.RulesFile = *alertRules
+	}
+	if set["notify-config"] {
+		cfg.Alerts.NotifyFile = *notifyFile
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// applyEnv applies the environment overrides: PORT, LISTEN_ADDR,
+// TLS_CERT_FILE, TLS_KEY_FILE, TLS_CLIENT_CA_FILE, TLS_SELF_SIGNED,
+// CORS_ORIGINS, AUTH_API_KEY (a key granting every scope),
+// AUTH_JWT_SECRET, COLLECTORS, SAMPLE_PERIOD_<NAME>, SAMPLE_TIMEOUT_<NAME>,
+// HISTORY_TIERS, ALERT_RULES and NOTIFY_CONFIG.
+func (cfg *Config) applyEnv() error {
+	if port := os.Getenv("PORT"); port != "" {
+		cfg.Listen = ":" + port
+	}
+	if v := os.Getenv("LISTEN_ADDR"); v != "" {
+		cfg.Listen = v
+	}
+	if v := os.Getenv("TLS_CERT_FILE"); v != "" {
+		cfg.TLS.CertFile = v
+	}
+	if v := os.Getenv("TLS_KEY_FILE"); v != "" {
+		cfg.TLS.KeyFile = v
+	}
+	if v := os.Getenv("TLS_CLIENT_CA_FILE"); v != "" {
+		cfg.TLS.ClientCAFile = v
+	}
+	if v := os.Getenv("TLS_SELF_SIGNED"); v != "" {
+		selfSigned, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("TLS_SELF_SIGNED: %v", err)
+		}
+		cfg.TLS.SelfSigned = selfSigned
+	}
+	if v := os.Getenv("CORS_ORIGINS"); v != "" {
+		cfg.CORS.AllowOrigins = splitList(v)
+	}
+	if v := os.Getenv("AUTH_API_KEY"); v != "" {
+		cfg.Auth.APIKeys = append(cfg.Auth.APIKeys, APIKeyConfig{Name: "env", Key: v, Scopes: []string{"*"}})
+	}
+	if v := os.Getenv("AUTH_JWT_SECRET"); v != "" {
+		if cfg.Auth.JWT == nil {
+			cfg.Auth.JWT = &JWTConfig{}
+		}
+		cfg.Auth.JWT.Secret = v
+		cfg.Auth.JWT.SecretEnv = ""
+	}
+	if v := os.Getenv("COLLECTORS"); v != "" {
+		cfg.enableOnly(splitList(v))
+	}
+
+	for name, c := range cfg.Collectors {
+		for suffix, field := range map[string]*Duration{"PERIOD": &c.Interval, "TIMEOUT": &c.Timeout} {
+			env := "SAMPLE_" + suffix + "_" + strings.ToUpper(name)
+			v := os.Getenv(env)
+			if v == "" {
+				continue
+			}
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return fmt.Errorf("%s: %v", env, err)
+			}
+			*field = Duration(d)
+		}
+		cfg.Collectors[name] = c
+	}
+
+	if v := os.Getenv("HISTORY_TIERS"); v != "" {
+		cfg.History.Tiers = v
+	}
+	if v := os.Getenv("ALERT_RULES"); v != "" {
+		cfg.Alerts.RulesFile = v
+	}
+	if v := os.Getenv("NOTIFY_CONFIG"); v != "" {
+		cfg.Alerts.NotifyFile = v
+	}
+	return nil
+}
+
+// enableOnly enables the named collectors and disables all others. Unknown
+// names are added so Validate reports them.
+func (cfg *Config) enableOnly(names []string) {
+	enabled := make(map[string]bool)
+	for _, name := range names {
+		enabled[name] = true
+		if _, ok := cfg.Collectors[name]; !ok {
+			cfg.Collectors[name] = CollectorConfig{}
+		}
+	}
+	for name, c := range cfg.Collectors {
+		on := enabled[name]
+		c.Enabled = &on
+		cfg.Collectors[name] = c
+	}
+}
+
+func (cfg *Config) setIntervals(s string) error {
+	for _, pair := range splitList(s) {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("invalid interval %q, expected name=duration", pair)
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid interval %q: %v", pair, err)
+		}
+		c := cfg.Collectors[name]
+		c.Interval = Duration(d)
+		cfg.Collectors[name] = c
+	}
+	return nil
+}
+
+// EnabledCollectors returns the names of the enabled collectors, sorted.
+func (cfg *Config) EnabledCollectors() []string {
+	var names []string
+	for name, c := range cfg.Collectors {
+		if c.IsEnabled() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
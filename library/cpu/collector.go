@@ -0,0 +1,132 @@
+package cpuinfo
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/cpu"
+	"github.com/shirou/gopsutil/v4/host"
+)
+
+// Usage is the share of a window a CPU spent in each mode, in percent.
+// Guest time is part of user and nice. Busy is everything but idle and
+// iowait.
+type Usage struct {
+	CPU     string  `json:"cpu"`
+	User    float64 `json:"user"`
+	Nice    float64 `json:"nice"`
+	System  float64 `json:"system"`
+	Idle    float64 `json:"idle"`
+	Iowait  float64 `json:"iowait"`
+	Irq     float64 `json:"irq"`
+	Softirq float64 `json:"softirq"`
+	Steal   float64 `json:"steal"`
+	Busy    float64 `json:"busy"`
+}
+
+// usage returns the share of each mode between prev and cur. Counters
+// that went backwards, as iowait can, count as zero.
+func usage(prev, cur cpu.TimesStat) Usage {
+	delta := func(a, b float64) float64 {
+		if b < a {
+			return 0
+		}
+		return b - a
+	}
+	u := Usage{
+		CPU:     cur.CPU,
+		User:    delta(prev.User, cur.User),
+		Nice:    delta(prev.Nice, cur.Nice),
+		System:  delta(prev.System, cur.System),
+		Idle:    delta(prev.Idle, cur.Idle),
+		Iowait:  delta(prev.Iowait, cur.Iowait),
+		Irq:     delta(prev.Irq, cur.Irq),
+		Softirq: delta(prev.Softirq, cur.Softirq),
+		Steal:   delta(prev.Steal, cur.Steal),
+	}
+
+	total := u.User + u.Nice + u.System + u.Idle + u.Iowait + u.Irq + u.Softirq + u.Steal
+	if total <= 0 {
+		return Usage{CPU: cur.CPU}
+	}
+	for _, mode := range []*float64{&u.User, &u.Nice, &u.System, &u.Idle, &u.Iowait, &u.Irq, &u.Softirq, &u.Steal} {
+		*mode = *mode / total * 100
+	}
+	u.Busy = 100 - u.Idle - u.Iowait
+	if u.Busy < 0 {
+		u.Busy = 0
+	}
+	return u
+}
+
+// Collector keeps the CPU times of the previous collection, so usage
+// covers the time between two collections rather than whatever another
+// caller sampled last.
+type Collector struct {
+	opts Options
+
+	mu       sync.Mutex
+	prev     map[string]cpu.TimesStat
+	prevTime time.Time
+}
+
+// Options controls where per-CPU frequency and topology are read from.
+type Options struct {
+	// Root is the sysfs CPU directory.
+	Root string
+}
+
+var DefaultOptions = Options{Root: "/sys/devices/system/cpu"}
+
+var defaultCollector = NewCollector(DefaultOptions)
+
+func NewCollector(opts Options) *Collector {
+	return &Collector{opts: opts}
+}
+
+// Collect gathers CPU info, usage since the previous call, times, the
+// load average, scheduling counters and the per-CPU topology.
+func (c *Collector) Collect(ctx context.Context) (Snapshot, error) {
+	snap, err := collect(ctx, c.usage)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	snap.Topology = readTopology(c.opts.Root)
+	return snap, nil
+}
+
+// usage computes the usage of every CPU and the total from the current
+// times. The first call has no previous times and covers the time since
+// boot.
+func (c *Collector) usage(ctx context.Context, perCore []cpu.TimesStat, total cpu.TimesStat) (Usage, []Usage, time.Duration, error) {
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	prev, prevTime := c.prev, c.prevTime
+	if prev == nil {
+		uptime, err := host.UptimeWithContext(ctx)
+		if err != nil {
+			return Usage{}, nil, 0, err
+		}
+		prev, prevTime = map[string]cpu.TimesStat{}, now.Add(-time.Duration(uptime)*time.Second)
+	}
+
+	cores := make([]Usage, 0, len(perCore))
+	for _, t := range perCore {
+		// CPUs brought online since the last call start from zero.
+		cores = append(cores, usage(prev[t.CPU], t))
+	}
+	all := usage(prev[total.CPU], total)
+
+	c.prev = make(map[string]cpu.TimesStat, len(perCore)+1)
+	for _, t := range perCore {
+		c.prev[t.CPU] = t
+	}
+	c.prev[total.CPU] = total
+	c.prevTime = now
+
+	return all, cores, now.Sub(prevTime), nil
+}
@@ -2,106 +2,153 @@ package cpuinfo
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/shirou/gopsutil/v4/cpu"
 )
 
-func GetCPUInfo(c *gin.Context) {
-	var wg sync.WaitGroup
-	cpuInfoChan := make(chan []cpu.InfoStat)
-	cpuPercentChan := make(chan []float64)
-	cpuTimesChan := make(chan []cpu.TimesStat)
-	errChan := make(chan error, 3)
+// Snapshot is a point-in-time view of the CPUs. Percent, PercentPerCore
+// and the usage breakdowns cover the window before the collection.
+type Snapshot struct {
+	Info           []cpu.InfoStat  `json:"cpu_info"`
+	CountPhysical  int             `json:"cpu_count_physical"`
+	CountLogical   int             `json:"cpu_count_logical"`
+	Percent        float64         `json:"cpu_percent"`
+	PercentPerCore []float64       `json:"cpu_percent_per_core"`
+	Usage          Usage           `json:"cpu_usage"`
+	UsagePerCore   []Usage         `json:"cpu_usage_per_core"`
+	Window         float64         `json:"window_seconds"`
+	Times          []cpu.TimesStat `json:"cpu_times"`
+	Load           *LoadAvg        `json:"load_avg"`
+	Stats          *Stats          `json:"cpu_stats"`
+	// Topology is nil where sysfs is not available.
+	Topology *Topology `json:"cpu_topology,omitempty"`
+}
+
+// Collect gathers CPU info, usage since the previous call, times, the load
+// average and scheduling counters.
+func Collect(ctx context.Context) (Snapshot, error) {
+	return defaultCollector.Collect(ctx)
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 0)
-	defer cancel()
+type usageFunc func(ctx context.Context, perCore []cpu.TimesStat, total cpu.TimesStat) (Usage, []Usage, time.Duration, error)
+
+func collect(ctx context.Context, usage usageFunc) (Snapshot, error) {
+	var wg sync.WaitGroup
+	var cpuInfo []cpu.InfoStat
+	var cpuTimes []cpu.TimesStat
+	var totalTimes []cpu.TimesStat
+	var loadAvg *LoadAvg
+	var stats *Stats
+	errChan := make(chan error, 5)
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		info, err := cpu.Info()
+		info, err := cpu.InfoWithContext(ctx)
 		if err != nil {
 			errChan <- err
 			return
 		}
-		cpuInfoChan <- info
+		cpuInfo = info
 	}()
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		percent, err := cpu.Percent(0, true)
+		times, err := cpu.TimesWithContext(ctx, true)
 		if err != nil {
 			errChan <- err
 			return
 		}
-		cpuPercentChan <- percent
+		cpuTimes = times
 	}()
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		times, err := cpu.TimesWithContext(ctx, true)
+		times, err := cpu.TimesWithContext(ctx, false)
 		if err != nil {
 			errChan <- err
 			return
 		}
-		cpuTimesChan <- times
+		totalTimes = times
 	}()
 
+	wg.Add(1)
 	go func() {
-		wg.Wait()
-		close(cpuInfoChan)
-		close(cpuPercentChan)
-		close(cpuTimesChan)
-		close(errChan)
-	}()
-
-	var err error
-	select {
-	case err = <-errChan:
+		defer wg.Done()
+		avg, err := readLoadAvg(ctx)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			errChan <- err
 			return
 		}
-	case cpuInfo := <-cpuInfoChan:
-		var cpuPercent []float64
-		select {
-		case cpuPercent = <-cpuPercentChan:
-		case err = <-errChan:
-		}
-		var cpuTimes []cpu.TimesStat
-		select {
-		case cpuTimes = <-cpuTimesChan:
-		case err = <-errChan:
-		}
+		loadAvg = avg
+	}()
 
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s, err := readStats(ctx)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			errChan <- err
 			return
 		}
+		stats = s
+	}()
 
-		logicalCPUCount, err := cpu.Counts(true)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
+	wg.Wait()
+	close(errChan)
+	if err := <-errChan; err != nil {
+		return Snapshot{}, err
+	}
+	if len(totalTimes) == 0 {
+		return Snapshot{}, errors.New("no total CPU times")
+	}
 
-		physicalCPUCount, err := cpu.Counts(false)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
+	total, perCore, window, err := usage(ctx, cpuTimes, totalTimes[0])
+	if err != nil {
+		return Snapshot{}, err
+	}
+	percentPerCore := make([]float64, len(perCore))
+	for i, u := range perCore {
+		percentPerCore[i] = u.Busy
+	}
 
-		c.JSON(http.StatusOK, gin.H{
-			"cpu_info":             cpuInfo,
-			"cpu_count_physical":   physicalCPUCount,
-			"cpu_count_logical":    logicalCPUCount,
-			"cpu_percent_per_core": cpuPercent,
-			"cpu_times":            cpuTimes,
-		})
+	logicalCPUCount, err := cpu.CountsWithContext(ctx, true)
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	physicalCPUCount, err := cpu.CountsWithContext(ctx, false)
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	return Snapshot{
+		Info:           cpuInfo,
+		CountPhysical:  physicalCPUCount,
+		CountLogical:   logicalCPUCount,
+		Percent:        total.Busy,
+		PercentPerCore: percentPerCore,
+		Usage:          total,
+		UsagePerCore:   perCore,
+		Window:         window.Seconds(),
+		Times:          cpuTimes,
+		Load:           loadAvg,
+		Stats:          stats,
+	}, nil
+}
+
+func GetCPUInfo(c *gin.Context) {
+	snap, err := Collect(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
+	c.JSON(http.StatusOK, snap)
 }
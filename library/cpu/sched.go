@@ -0,0 +1,26 @@
+package cpuinfo
+
+// LoadAvg is the system load average over 1, 5 and 15 minutes. Running
+// and Total are the runnable and existing scheduling entities, i.e. the
+// run queue length and the number of tasks.
+type LoadAvg struct {
+	Load1   float64 `json:"load1"`
+	Load5   float64 `json:"load5"`
+	Load15  float64 `json:"load15"`
+	Running int     `json:"running,omitempty"`
+	Total   int     `json:"total,omitempty"`
+}
+
+// Stats are the scheduling counters of the system since boot, plus the
+// tasks currently running or blocked on IO.
+type Stats struct {
+	ContextSwitches  uint64 `json:"ctx_switches"`
+	Interrupts       uint64 `json:"interrupts"`
+	SoftInterrupts   uint64 `json:"soft_interrupts"`
+	ProcessesCreated uint64 `json:"processes_created"`
+	ProcsRunning     uint64 `json:"procs_running"`
+	ProcsBlocked     uint64 `json:"procs_blocked"`
+	// SoftIRQs counts soft interrupts by type, summed over all CPUs, e.g.
+	// NET_RX or TIMER.
+	SoftIRQs map[string]uint64 `json:"softirqs,omitempty"`
+}
@@ -0,0 +1,98 @@
+package cpuinfo
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const procRoot = "/proc"
+
+// readLoadAvg parses /proc/loadavg, e.g. "0.29 0.28 0.28 2/72 17767".
+func readLoadAvg(ctx context.Context) (*LoadAvg, error) {
+	data, err := os.ReadFile(filepath.Join(procRoot, "loadavg"))
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 4 {
+		return nil, fmt.Errorf("loadavg: unexpected format %q", data)
+	}
+
+	var load LoadAvg
+	for i, field := range []*float64{&load.Load1, &load.Load5, &load.Load15} {
+		if *field, err = strconv.ParseFloat(fields[i], 64); err != nil {
+			return nil, fmt.Errorf("loadavg: %v", err)
+		}
+	}
+	running, total, _ := strings.Cut(fields[3], "/")
+	load.Running, _ = strconv.Atoi(running)
+	load.Total, _ = strconv.Atoi(total)
+	return &load, nil
+}
+
+// readStats reads the counters in /proc/stat and the per-type soft
+// interrupts in /proc/softirqs, which is optional.
+func readStats(ctx context.Context) (*Stats, error) {
+	data, err := os.ReadFile(filepath.Join(procRoot, "stat"))
+	if err != nil {
+		return nil, err
+	}
+
+	var stats Stats
+	counters := map[string]*uint64{
+		"ctxt":          &stats.ContextSwitches,
+		"intr":          &stats.Interrupts,
+		"softirq":       &stats.SoftInterrupts,
+		"processes":     &stats.ProcessesCreated,
+		"procs_running": &stats.ProcsRunning,
+		"procs_blocked": &stats.ProcsBlocked,
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		// intr and softirq are followed by per-source counts; the first
+		// value is the total.
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		if counter, ok := counters[fields[0]]; ok {
+			*counter, _ = strconv.ParseUint(fields[1], 10, 64)
+		}
+	}
+
+	if softirqs, err := readSoftIRQs(); err == nil {
+		stats.SoftIRQs = softirqs
+	}
+	return &stats, nil
+}
+
+// readSoftIRQs sums each row of /proc/softirqs over the CPU columns.
+func readSoftIRQs() (map[string]uint64, error) {
+	data, err := os.ReadFile(filepath.Join(procRoot, "softirqs"))
+	if err != nil {
+		return nil, err
+	}
+
+	softirqs := make(map[string]uint64)
+	lines := strings.Split(string(data), "\n")
+	// The first line names the CPU columns.
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		var sum uint64
+		for _, field := range fields[1:] {
+			n, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				continue
+			}
+			sum += n
+		}
+		softirqs[strings.TrimSuffix(fields[0], ":")] = sum
+	}
+	return softirqs, nil
+}
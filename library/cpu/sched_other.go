@@ -0,0 +1,31 @@
+//go:build !linux
+
+package cpuinfo
+
+import (
+	"context"
+
+	"github.com/shirou/gopsutil/v4/load"
+)
+
+func readLoadAvg(ctx context.Context) (*LoadAvg, error) {
+	avg, err := load.AvgWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &LoadAvg{Load1: avg.Load1, Load5: avg.Load5, Load15: avg.Load15}, nil
+}
+
+// readStats returns the counters gopsutil can read on this platform;
+// interrupt counts are only available on Linux.
+func readStats(ctx context.Context) (*Stats, error) {
+	misc, err := load.MiscWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Stats{
+		ContextSwitches: uint64(misc.Ctxt),
+		ProcsRunning:    uint64(misc.ProcsRunning),
+		ProcsBlocked:    uint64(misc.ProcsBlocked),
+	}, nil
+}
@@ -0,0 +1,191 @@
+package cpuinfo
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Frequency is the frequency scaling state of a CPU in MHz. MinMHz and
+// MaxMHz are the limits set by the governor, HardwareMinMHz and
+// HardwareMaxMHz those of the hardware.
+type Frequency struct {
+	CurrentMHz     float64 `json:"current_mhz"`
+	MinMHz         float64 `json:"min_mhz"`
+	MaxMHz         float64 `json:"max_mhz"`
+	HardwareMinMHz float64 `json:"hardware_min_mhz,omitempty"`
+	HardwareMaxMHz float64 `json:"hardware_max_mhz,omitempty"`
+	Governor       string  `json:"governor,omitempty"`
+	Driver         string  `json:"driver,omitempty"`
+}
+
+// Throttle counts how often a CPU was throttled because its core or
+// package ran too hot, since boot.
+type Throttle struct {
+	CoreCount    uint64 `json:"core_throttle_count"`
+	PackageCount uint64 `json:"package_throttle_count"`
+}
+
+// CoreInfo is the placement and state of one logical CPU. Socket, Core
+// and NUMANode are -1 when unknown, e.g. for offline CPUs. Frequency and
+// Throttle are nil when the kernel does not expose them, as in many VMs.
+type CoreInfo struct {
+	CPU            int        `json:"cpu"`
+	Online         bool       `json:"online"`
+	Socket         int        `json:"socket"`
+	Core           int        `json:"core"`
+	NUMANode       int        `json:"numa_node"`
+	ThreadSiblings []int      `json:"thread_siblings,omitempty"`
+	Frequency      *Frequency `json:"frequency,omitempty"`
+	Throttle       *Throttle  `json:"throttle,omitempty"`
+}
+
+// Topology summarizes how the logical CPUs map onto sockets, physical
+// cores and NUMA nodes.
+type Topology struct {
+	Sockets   int        `json:"sockets"`
+	Cores     int        `json:"cores"`
+	Threads   int        `json:"threads"`
+	NUMANodes int        `json:"numa_nodes"`
+	CPUs      []CoreInfo `json:"cpus"`
+}
+
+var cpuDirPattern = regexp.MustCompile(`^cpu(\d+)$`)
+var nodeDirPattern = regexp.MustCompile(`^node(\d+)$`)
+
+// readTopology reads every cpuN directory under root, normally
+// /sys/devices/system/cpu. It returns nil if there are none.
+func readTopology(root string) *Topology {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil
+	}
+
+	var cpus []CoreInfo
+	for _, entry := range entries {
+		m := cpuDirPattern.FindStringSubmatch(entry.Name())
+		if m == nil {
+			continue
+		}
+		n, _ := strconv.Atoi(m[1])
+		cpus = append(cpus, readCore(filepath.Join(root, entry.Name()), n))
+	}
+	if len(cpus) == 0 {
+		return nil
+	}
+	sort.Slice(cpus, func(i, j int) bool { return cpus[i].CPU < cpus[j].CPU })
+
+	t := &Topology{Threads: len(cpus), CPUs: cpus}
+	sockets := make(map[int]bool)
+	cores := make(map[[2]int]bool)
+	nodes := make(map[int]bool)
+	for _, c := range cpus {
+		if c.Socket >= 0 {
+			sockets[c.Socket] = true
+			cores[[2]int{c.Socket, c.Core}] = true
+		}
+		if c.NUMANode >= 0 {
+			nodes[c.NUMANode] = true
+		}
+	}
+	t.Sockets, t.Cores, t.NUMANodes = len(sockets), len(cores), len(nodes)
+	return t
+}
+
+func readCore(dir string, n int) CoreInfo {
+	c := CoreInfo{CPU: n, Online: true, Socket: -1, Core: -1, NUMANode: -1}
+
+	// cpu0 usually cannot be taken offline and has no online file.
+	if online, err := readString(filepath.Join(dir, "online")); err == nil {
+		c.Online = online == "1"
+	}
+
+	if v, err := readInt(filepath.Join(dir, "topology", "physical_package_id")); err == nil {
+		c.Socket = v
+	}
+	if v, err := readInt(filepath.Join(dir, "topology", "core_id")); err == nil {
+		c.Core = v
+	}
+	if v, err := readString(filepath.Join(dir, "topology", "thread_siblings_list")); err == nil {
+		c.ThreadSiblings = parseCPUList(v)
+	}
+
+	if entries, err := os.ReadDir(dir); err == nil {
+		for _, entry := range entries {
+			if m := nodeDirPattern.FindStringSubmatch(entry.Name()); m != nil {
+				c.NUMANode, _ = strconv.Atoi(m[1])
+				break
+			}
+		}
+	}
+
+	// Frequencies are in kHz.
+	freq := filepath.Join(dir, "cpufreq")
+	if cur, err := readInt(filepath.Join(freq, "scaling_cur_freq")); err == nil {
+		f := &Frequency{CurrentMHz: float64(cur) / 1000}
+		for file, field := range map[string]*float64{
+			"scaling_min_freq": &f.MinMHz,
+			"scaling_max_freq": &f.MaxMHz,
+			"cpuinfo_min_freq": &f.HardwareMinMHz,
+			"cpuinfo_max_freq": &f.HardwareMaxMHz,
+		} {
+			if v, err := readInt(filepath.Join(freq, file)); err == nil {
+				*field = float64(v) / 1000
+			}
+		}
+		f.Governor, _ = readString(filepath.Join(freq, "scaling_governor"))
+		f.Driver, _ = readString(filepath.Join(freq, "scaling_driver"))
+		c.Frequency = f
+	}
+
+	throttle := filepath.Join(dir, "thermal_throttle")
+	if core, err := readInt(filepath.Join(throttle, "core_throttle_count")); err == nil {
+		t := &Throttle{CoreCount: uint64(core)}
+		if pkg, err := readInt(filepath.Join(throttle, "package_throttle_count")); err == nil {
+			t.PackageCount = uint64(pkg)
+		}
+		c.Throttle = t
+	}
+	return c
+}
+
+// parseCPUList parses a kernel CPU list such as "0-3,8,10-11".
+func parseCPUList(s string) []int {
+	var cpus []int
+	for _, part := range strings.Split(s, ",") {
+		lo, hi, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		from, err := strconv.Atoi(lo)
+		if err != nil {
+			continue
+		}
+		to := from
+		if isRange {
+			if to, err = strconv.Atoi(hi); err != nil {
+				continue
+			}
+		}
+		for n := from; n <= to; n++ {
+			cpus = append(cpus, n)
+		}
+	}
+	return cpus
+}
+
+func readString(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func readInt(path string) (int, error) {
+	s, err := readString(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(s)
+}
@@ -0,0 +1,77 @@
+package cpuinfo
+
+import (
+	"reflect"
+	"testing"
+)
+
+// The fixture has a cpu0 with frequency scaling and throttle counters, an
+// offline cpu1 without topology, a cpu2 with only some of the cpufreq and
+// thermal_throttle files, and a cpu3 and cpu10 on a second socket without
+// either, as in many VMs.
+func TestReadTopology(t *testing.T) {
+	got := readTopology("testdata/cpu")
+	if got == nil {
+		t.Fatal("readTopology = nil")
+	}
+
+	want := &Topology{
+		Sockets:   2,
+		Cores:     3,
+		Threads:   5,
+		NUMANodes: 2,
+		CPUs: []CoreInfo{
+			{
+				CPU: 0, Online: true, Socket: 0, Core: 0, NUMANode: 0,
+				ThreadSiblings: []int{0, 2},
+				Frequency: &Frequency{
+					CurrentMHz: 2400, MinMHz: 800, MaxMHz: 3600,
+					HardwareMinMHz: 400, HardwareMaxMHz: 4000,
+					Governor: "powersave", Driver: "intel_pstate",
+				},
+				Throttle: &Throttle{CoreCount: 5, PackageCount: 2},
+			},
+			{CPU: 1, Online: false, Socket: -1, Core: -1, NUMANode: -1},
+			{
+				CPU: 2, Online: true, Socket: 0, Core: 0, NUMANode: 0,
+				ThreadSiblings: []int{0, 2},
+				Frequency:      &Frequency{CurrentMHz: 1200},
+				Throttle:       &Throttle{CoreCount: 1},
+			},
+			{CPU: 3, Online: true, Socket: 1, Core: 4, NUMANode: 1, ThreadSiblings: []int{3}},
+			{CPU: 10, Online: true, Socket: 1, Core: 5, NUMANode: 1, ThreadSiblings: []int{10}},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readTopology =\n%+v\nwant\n%+v", got, want)
+		for i := range got.CPUs {
+			if i < len(want.CPUs) && !reflect.DeepEqual(got.CPUs[i], want.CPUs[i]) {
+				t.Errorf("cpu %d = %+v, want %+v", got.CPUs[i].CPU, got.CPUs[i], want.CPUs[i])
+			}
+		}
+	}
+}
+
+func TestReadTopologyMissing(t *testing.T) {
+	if got := readTopology("testdata/missing"); got != nil {
+		t.Errorf("readTopology of a missing root = %+v, want nil", got)
+	}
+	if got := readTopology(t.TempDir()); got != nil {
+		t.Errorf("readTopology without cpu directories = %+v, want nil", got)
+	}
+}
+
+func TestParseCPUList(t *testing.T) {
+	for s, want := range map[string][]int{
+		"0":           {0},
+		"0-3":         {0, 1, 2, 3},
+		"0-3,8,10-11": {0, 1, 2, 3, 8, 10, 11},
+		" 0,2 ":       {0, 2},
+		"":            nil,
+		"x,1,2-y,4-5": {1, 4, 5},
+	} {
+		if got := parseCPUList(s); !reflect.DeepEqual(got, want) {
+			t.Errorf("parseCPUList(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
@@ -3,7 +3,8 @@ package diskinfo
 import (
 	"context"
 	"net/http"
-	"os"
+	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 
@@ -11,66 +12,164 @@ import (
 	"github.com/shirou/gopsutil/v4/disk"
 )
 
-func GetDiskInfo(c *gin.Context) {
-	partitions, err := disk.Partitions(true)
+// Partition holds usage and IO counters of one mounted partition. Error is
+// set, and usage left zero, when the usage could not be read. BindMounts
+// lists the other mountpoints of the same filesystem.
+type Partition struct {
+	Device       string   `json:"device"`
+	Mountpoint   string   `json:"mountpoint"`
+	Filesystem   string   `json:"filesystem"`
+	TotalSpace   uint64   `json:"total_space"`
+	UsedSpace    uint64   `json:"used_space"`
+	FreeSpace    uint64   `json:"free_space"`
+	UsedPercent  float64  `json:"used_percent"`
+	IOReadCount  uint64   `json:"io_read_count"`
+	IOWriteCount uint64   `json:"io_write_count"`
+	IOReadBytes  uint64   `json:"io_read_bytes"`
+	IOWriteBytes uint64   `json:"io_write_bytes"`
+	Label        string   `json:"label"`
+	SerialNumber string   `json:"serial_number"`
+	BindMounts   []string `json:"bind_mounts,omitempty"`
+	Error        string   `json:"error,omitempty"`
+}
+
+// Snapshot is a point-in-time view of all mounted partitions, sorted by
+// mountpoint.
+type Snapshot struct {
+	Partitions []Partition `json:"partitions"`
+}
+
+// DefaultTimeout bounds a collection started from GetDiskInfo.
+const DefaultTimeout = 5 * time.Second
+
+// Options controls which partitions are reported.
+type Options struct {
+	Filter Filter
+}
+
+var DefaultOptions = Options{Filter: Filter{ExcludeFstypes: VirtualFstypes}}
+
+// Collect gathers usage and IO counters for the partitions selected by
+// DefaultOptions.
+func Collect(ctx context.Context) (Snapshot, error) {
+	return CollectWithOptions(ctx, DefaultOptions)
+}
+
+// mount is a partition along with the filesystem it belongs to, if known.
+type mount struct {
+	Partition
+	fsID  uint64
+	hasID bool
+}
+
+// CollectWithOptions gathers usage and IO counters for every mounted
+// partition passing opts.Filter. Bind mounts of a filesystem are reported
+// once, under the shortest mountpoint.
+func CollectWithOptions(ctx context.Context, opts Options) (Snapshot, error) {
+	partitions, err := disk.PartitionsWithContext(ctx, true)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+		return Snapshot{}, err
 	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5) // Set a timeout of 5 seconds
-	defer cancel()
+	// Counters of all devices are read at once rather than per partition.
+	ioCounters, _ := disk.IOCountersWithContext(ctx)
 
 	var wg sync.WaitGroup
-	diskInfo := make([]gin.H, 0, len(partitions))
-	infoCh := make(chan gin.H)
+	mounts := make([]mount, 0, len(partitions))
+	mountCh := make(chan mount)
 
 	for _, partition := range partitions {
+		if !opts.Filter.Match(partition.Device, partition.Mountpoint, partition.Fstype) {
+			continue
+		}
 		wg.Add(1)
 
 		go func(partition disk.PartitionStat) {
 			defer wg.Done()
 
-			usage, err := disk.Usage(partition.Mountpoint)
+			ioCounter := ioCounters[deviceName(partition.Device)]
+			m := mount{Partition: Partition{
+				Device:       partition.Device,
+				Mountpoint:   partition.Mountpoint,
+				Filesystem:   partition.Fstype,
+				IOReadCount:  ioCounter.ReadCount,
+				IOWriteCount: ioCounter.WriteCount,
+				IOReadBytes:  ioCounter.ReadBytes,
+				IOWriteBytes: ioCounter.WriteBytes,
+				Label:        partition.Fstype,
+				SerialNumber: partition.Device,
+			}}
+
+			usage, err := disk.UsageWithContext(ctx, partition.Mountpoint)
 			if err != nil {
-				if os.IsPermission(err) {
-					return
-				}
-				return
+				m.Error = err.Error()
+			} else {
+				m.TotalSpace = usage.Total
+				m.UsedSpace = usage.Used
+				m.FreeSpace = usage.Free
+				m.UsedPercent = usage.UsedPercent
+				m.fsID, m.hasID = filesystemID(partition.Mountpoint)
 			}
 
-			ioCounters, _ := disk.IOCountersWithContext(ctx, partition.Device)
-			ioCounter := ioCounters[partition.Device]
-
-			label := partition.Fstype
-			serialNumber := partition.Device
-
-			infoCh <- gin.H{
-				"device":         partition.Device,
-				"mountpoint":     partition.Mountpoint,
-				"filesystem":     partition.Fstype,
-				"total_space":    usage.Total,
-				"used_space":     usage.Used,
-				"free_space":     usage.Free,
-				"used_percent":   usage.UsedPercent,
-				"io_read_count":  ioCounter.ReadCount,
-				"io_write_count": ioCounter.WriteCount,
-				"io_read_bytes":  ioCounter.ReadBytes,
-				"io_write_bytes": ioCounter.WriteBytes,
-				"label":          label,
-				"serial_number":  serialNumber,
-			}
+			mountCh <- m
 		}(partition)
 	}
 
 	go func() {
 		wg.Wait()
-		close(infoCh)
+		close(mountCh)
 	}()
 
-	for info := range infoCh {
-		diskInfo = append(diskInfo, info)
+	for m := range mountCh {
+		mounts = append(mounts, m)
+	}
+
+	return Snapshot{Partitions: dedupe(mounts)}, nil
+}
+
+// dedupe merges mounts of the same filesystem into the one with the
+// shortest mountpoint, normally the original rather than a bind mount.
+func dedupe(mounts []mount) []Partition {
+	sort.Slice(mounts, func(i, j int) bool {
+		if a, b := len(mounts[i].Mountpoint), len(mounts[j].Mountpoint); a != b {
+			return a < b
+		}
+		return mounts[i].Mountpoint < mounts[j].Mountpoint
+	})
+
+	partitions := make([]Partition, 0, len(mounts))
+	first := make(map[uint64]int)
+	for _, m := range mounts {
+		if m.hasID {
+			if i, ok := first[m.fsID]; ok {
+				partitions[i].BindMounts = append(partitions[i].BindMounts, m.Mountpoint)
+				continue
+			}
+			first[m.fsID] = len(partitions)
+		}
+		partitions = append(partitions, m.Partition)
+	}
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i].Mountpoint < partitions[j].Mountpoint })
+	return partitions
+}
+
+// deviceName returns the name the kernel knows a device by, e.g. "sda1"
+// for /dev/sda1 and "dm-0" for /dev/mapper/root.
+func deviceName(device string) string {
+	if resolved, err := filepath.EvalSymlinks(device); err == nil {
+		device = resolved
+	}
+	return filepath.Base(device)
+}
+
+func GetDiskInfo(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), DefaultTimeout)
+	defer cancel()
+
+	snap, err := Collect(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
-	c.JSON(http.StatusOK, diskInfo)
+	c.JSON(http.StatusOK, snap.Partitions)
 }
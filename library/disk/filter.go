@@ -0,0 +1,76 @@
+package diskinfo
+
+import (
+	"path/filepath"
+	"slices"
+)
+
+// VirtualFstypes are pseudo and in-memory filesystems, and read-only
+// images such as snaps, excluded by default.
+var VirtualFstypes = []string{
+	"autofs", "binfmt_misc", "bpf", "cgroup", "cgroup2", "configfs", "debugfs",
+	"devpts", "devtmpfs", "efivarfs", "fuse.gvfsd-fuse", "fuse.lxcfs", "fusectl",
+	"hugetlbfs", "mqueue", "nsfs", "overlay", "proc", "pstore", "ramfs",
+	"rpc_pipefs", "securityfs", "selinuxfs", "squashfs", "sysfs", "tmpfs", "tracefs",
+}
+
+// Filter selects the partitions to report. A partition is reported if it
+// matches every non-empty include list and no exclude list. Fstypes match
+// exactly; mountpoints and devices are glob patterns as in filepath.Match,
+// and a mountpoint pattern also matches everything mounted below it, so
+// "/snap/*" matches /snap/core/123.
+type Filter struct {
+	IncludeFstypes     []string
+	ExcludeFstypes     []string
+	IncludeMountpoints []string
+	ExcludeMountpoints []string
+	IncludeDevices     []string
+	ExcludeDevices     []string
+}
+
+// Match reports whether a partition passes the filter.
+func (f Filter) Match(device, mountpoint, fstype string) bool {
+	fstypes := func(patterns []string) bool { return slices.Contains(patterns, fstype) }
+	mountpoints := func(patterns []string) bool { return matchPath(patterns, mountpoint) }
+	devices := func(patterns []string) bool { return matchGlob(patterns, device) }
+
+	for _, rule := range []struct {
+		include, exclude []string
+		match            func([]string) bool
+	}{
+		{f.IncludeFstypes, f.ExcludeFstypes, fstypes},
+		{f.IncludeMountpoints, f.ExcludeMountpoints, mountpoints},
+		{f.IncludeDevices, f.ExcludeDevices, devices},
+	} {
+		if len(rule.include) > 0 && !rule.match(rule.include) {
+			return false
+		}
+		if rule.match(rule.exclude) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchGlob(patterns []string, s string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPath matches p and each of its parent directories against patterns.
+func matchPath(patterns []string, p string) bool {
+	for {
+		if matchGlob(patterns, p) {
+			return true
+		}
+		parent := filepath.Dir(p)
+		if parent == p {
+			return false
+		}
+		p = parent
+	}
+}
@@ -0,0 +1,140 @@
+package diskinfo
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shirou/gopsutil/v4/disk"
+	"github.com/shirou/gopsutil/v4/host"
+)
+
+// DeviceIO is the IO of one block device over the window before a
+// collection. Await is the average time a request took including queueing,
+// QueueDepth the average number of requests in flight and UtilPercent the
+// share of time the device was busy, as reported by iostat.
+type DeviceIO struct {
+	Device              string  `json:"device"`
+	ReadIOPS            float64 `json:"read_iops"`
+	WriteIOPS           float64 `json:"write_iops"`
+	ReadBytesPerSecond  float64 `json:"read_bytes_per_second"`
+	WriteBytesPerSecond float64 `json:"write_bytes_per_second"`
+	ReadAwaitMs         float64 `json:"read_await_ms"`
+	WriteAwaitMs        float64 `json:"write_await_ms"`
+	AwaitMs             float64 `json:"await_ms"`
+	QueueDepth          float64 `json:"queue_depth"`
+	InFlight            uint64  `json:"in_flight"`
+	UtilPercent         float64 `json:"util_percent"`
+}
+
+// IOSnapshot is the IO of every block device, sorted by device.
+type IOSnapshot struct {
+	Window  float64    `json:"window_seconds"`
+	Devices []DeviceIO `json:"devices"`
+}
+
+// IOCollector keeps the counters of the previous collection, so rates
+// cover the time between two collections.
+type IOCollector struct {
+	mu       sync.Mutex
+	prev     map[string]disk.IOCountersStat
+	prevTime time.Time
+}
+
+var defaultIOCollector = NewIOCollector()
+
+func NewIOCollector() *IOCollector {
+	return &IOCollector{}
+}
+
+// CollectIO computes the IO of every block device since the previous call.
+func CollectIO(ctx context.Context) (IOSnapshot, error) {
+	return defaultIOCollector.Collect(ctx)
+}
+
+// Collect reads the counters of all block devices at once and computes
+// their rates. The first call has no previous counters and covers the
+// time since boot.
+func (c *IOCollector) Collect(ctx context.Context) (IOSnapshot, error) {
+	counters, err := disk.IOCountersWithContext(ctx)
+	if err != nil {
+		return IOSnapshot{}, err
+	}
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	prev, prevTime := c.prev, c.prevTime
+	if prev == nil {
+		uptime, err := host.UptimeWithContext(ctx)
+		if err != nil {
+			return IOSnapshot{}, err
+		}
+		prev, prevTime = map[string]disk.IOCountersStat{}, now.Add(-time.Duration(uptime)*time.Second)
+	}
+	c.prev, c.prevTime = counters, now
+
+	window := now.Sub(prevTime)
+	snap := IOSnapshot{Window: window.Seconds(), Devices: make([]DeviceIO, 0, len(counters))}
+	for name, cur := range counters {
+		// Devices attached since the last call start from zero.
+		snap.Devices = append(snap.Devices, deviceIO(name, prev[name], cur, window))
+	}
+	sort.Slice(snap.Devices, func(i, j int) bool { return snap.Devices[i].Device < snap.Devices[j].Device })
+	return snap, nil
+}
+
+// deviceIO computes the rates of a device between two readings. Times in
+// the counters are in milliseconds.
+func deviceIO(name string, prev, cur disk.IOCountersStat, window time.Duration) DeviceIO {
+	delta := func(a, b uint64) float64 {
+		// Counters reset when a device is detached and re-attached.
+		if b < a {
+			return 0
+		}
+		return float64(b - a)
+	}
+	reads, writes := delta(prev.ReadCount, cur.ReadCount), delta(prev.WriteCount, cur.WriteCount)
+	readTime, writeTime := delta(prev.ReadTime, cur.ReadTime), delta(prev.WriteTime, cur.WriteTime)
+
+	d := DeviceIO{Device: name, InFlight: cur.IopsInProgress}
+	seconds := window.Seconds()
+	if seconds <= 0 {
+		return d
+	}
+	ms := seconds * 1000
+
+	d.ReadIOPS = reads / seconds
+	d.WriteIOPS = writes / seconds
+	d.ReadBytesPerSecond = delta(prev.ReadBytes, cur.ReadBytes) / seconds
+	d.WriteBytesPerSecond = delta(prev.WriteBytes, cur.WriteBytes) / seconds
+	if reads > 0 {
+		d.ReadAwaitMs = readTime / reads
+	}
+	if writes > 0 {
+		d.WriteAwaitMs = writeTime / writes
+	}
+	if reads+writes > 0 {
+		d.AwaitMs = (readTime + writeTime) / (reads + writes)
+	}
+	d.QueueDepth = delta(prev.WeightedIO, cur.WeightedIO) / ms
+	d.UtilPercent = min(delta(prev.IoTime, cur.IoTime)/ms*100, 100)
+	return d
+}
+
+func GetDiskIOInfo(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), DefaultTimeout)
+	defer cancel()
+
+	snap, err := CollectIO(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, snap)
+}
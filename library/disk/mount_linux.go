@@ -0,0 +1,13 @@
+package diskinfo
+
+import "syscall"
+
+// filesystemID returns the device number of the filesystem mounted at
+// mountpoint. Bind mounts of the same filesystem share it.
+func filesystemID(mountpoint string) (uint64, bool) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(mountpoint, &st); err != nil {
+		return 0, false
+	}
+	return uint64(st.Dev), true
+}
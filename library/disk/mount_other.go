@@ -0,0 +1,8 @@
+//go:build !linux
+
+package diskinfo
+
+// filesystemID is only implemented on Linux, where bind mounts exist.
+func filesystemID(mountpoint string) (uint64, bool) {
+	return 0, false
+}
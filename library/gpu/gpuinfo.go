@@ -23,6 +23,11 @@ type GpuInfo struct {
 	NvidiaMemory NvResult `json:"nvidia_memory"`
 }
 
+// Snapshot holds the GPU samples taken during one collection.
+type Snapshot struct {
+	Samples []GpuInfo `json:"samples"`
+}
+
 func parseNvidiaSmiOutput(output string) (NvResult, error) {
 	lines := strings.Split(output, "\n")
 	var free, used, total uint64
@@ -50,8 +55,8 @@ func parseNvidiaSmiOutput(output string) (NvResult, error) {
 	return NvResult{Free: free, Used: used, Total: total}, nil
 }
 
-func pollNvidiaGpuMemory() (NvResult, error) {
-	cmd := exec.Command("nvidia-smi", "--query-gpu=memory.free,memory.used,memory.total", "--format=csv,noheader,nounits")
+func pollNvidiaGpuMemory(ctx context.Context) (NvResult, error) {
+	cmd := exec.CommandContext(ctx, "nvidia-smi", "--query-gpu=memory.free,memory.used,memory.total", "--format=csv,noheader,nounits")
 	output, err := cmd.Output()
 	if err != nil {
 		return NvResult{}, err
@@ -67,19 +72,45 @@ func channelWriter(ctx context.Context, wg *sync.WaitGroup, ch chan<- GpuInfo) {
 			return
 		default:
 
-			if nvidiaMemory, err := pollNvidiaGpuMemory(); err == nil {
+			if nvidiaMemory, err := pollNvidiaGpuMemory(ctx); err == nil {
 				gpuInfo := GpuInfo{
 					NvidiaMemory: nvidiaMemory,
 				}
-				ch <- gpuInfo
+				select {
+				case ch <- gpuInfo:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case <-time.After(1 * time.Second):
+			case <-ctx.Done():
+				return
 			}
-			time.Sleep(1 * time.Second)
 		}
 	}
 }
 
-func GetGpuInfo(c *gin.Context) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// Options controls how often nvidia-smi is polled per collection.
+type Options struct {
+	Polls int
+}
+
+var DefaultOptions = Options{Polls: 5}
+
+// DefaultTimeout bounds a collection started from GetGpuInfo.
+const DefaultTimeout = 5 * time.Second
+
+// Collect polls nvidia-smi with the default options.
+func Collect(ctx context.Context) (Snapshot, error) {
+	return CollectWithOptions(ctx, DefaultOptions)
+}
+
+// CollectWithOptions polls nvidia-smi up to opts.Polls times, once per
+// second, until ctx is done.
+func CollectWithOptions(ctx context.Context, opts Options) (Snapshot, error) {
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
 	ch := make(chan GpuInfo)
@@ -87,16 +118,32 @@ func GetGpuInfo(c *gin.Context) {
 	wg.Add(1)
 
 	go channelWriter(ctx, &wg, ch)
+	go func() {
+		wg.Wait()
+		close(ch)
+	}()
 
 	var results []GpuInfo
 	for info := range ch {
 		results = append(results, info)
-		if len(results) >= 5 {
+		if len(results) >= opts.Polls {
+			cancel()
 			break
 		}
 	}
 
-	wg.Wait()
+	return Snapshot{Samples: results}, nil
+}
+
+func GetGpuInfo(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), DefaultTimeout)
+	defer cancel()
+
+	snap, err := Collect(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
-	c.JSON(http.StatusOK, results)
+	c.JSON(http.StatusOK, snap.Samples)
 }
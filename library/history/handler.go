@@ -0,0 +1,88 @@
+package history
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parseTime accepts unix seconds, RFC3339 or a duration relative to now
+// such as "-15m".
+func parseTime(s string, now, def time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case s == "":
+		return def, nil
+	case s == "now":
+		return now, nil
+	case strings.HasPrefix(s, "-"):
+		d, err := time.ParseDuration(s[1:])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid relative time %q", s)
+		}
+		return now.Add(-d), nil
+	}
+
+	if secs, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Unix(0, int64(secs*1e9)), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q", s)
+	}
+	return t, nil
+}
+
+// ListHandler returns the names of all recorded metrics and how full the
+// store is.
+func (s *Store) ListHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"metrics": s.Metrics(), "stats": s.Stats()})
+}
+
+// QueryHandler serves /history/:metric?from=&to=&step=. Any other query
+// parameter selects series by label, e.g. &mountpoint=/.
+func (s *Store) QueryHandler(c *gin.Context) {
+	now := time.Now()
+
+	from, err := parseTime(c.Query("from"), now, now.Add(-time.Hour))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := parseTime(c.Query("to"), now, now)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var step time.Duration
+	if v := c.Query("step"); v != "" {
+		if step, err = time.ParseDuration(v); err != nil || step <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid step %q", v)})
+			return
+		}
+	}
+
+	selector := make(map[string]string)
+	for k, v := range c.Request.URL.Query() {
+		if k != "from" && k != "to" && k != "step" && len(v) > 0 {
+			selector[k] = v[0]
+		}
+	}
+
+	result, err := s.Query(c.Param("metric"), selector, from, to, step)
+	if errors.Is(err, ErrUnknownMetric) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,381 @@
+package history
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"checker/library/metric"
+)
+
+// maxPoints bounds the number of points returned per series by a query.
+const maxPoints = 11000
+
+// Tier keeps data at one resolution for one retention period. Tiers are
+// ordered from finest to coarsest; each recorded value is aggregated into
+// every tier, so older data survives only in the coarser tiers.
+type Tier struct {
+	Resolution time.Duration
+	Retention  time.Duration
+}
+
+var DefaultTiers = []Tier{
+	{Resolution: 10 * time.Second, Retention: time.Hour},
+	{Resolution: time.Minute, Retention: 24 * time.Hour},
+}
+
+// ParseTiers parses a list of resolution:retention pairs, e.g.
+// "10s:1h,1m:24h".
+func ParseTiers(s string) ([]Tier, error) {
+	var tiers []Tier
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		resolution, retention, ok := strings.Cut(part, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid tier %q, expected resolution:retention", part)
+		}
+		res, err := time.ParseDuration(resolution)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tier %q: %v", part, err)
+		}
+		ret, err := time.ParseDuration(retention)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tier %q: %v", part, err)
+		}
+		tiers = append(tiers, Tier{Resolution: res, Retention: ret})
+	}
+	return tiers, validateTiers(tiers)
+}
+
+func validateTiers(tiers []Tier) error {
+	if len(tiers) == 0 {
+		return errors.New("at least one history tier is required")
+	}
+	for i, t := range tiers {
+		if t.Resolution <= 0 || t.Retention < t.Resolution {
+			return fmt.Errorf("tier %d: need 0 < resolution <= retention, got %s:%s", i, t.Resolution, t.Retention)
+		}
+		if i > 0 && (t.Resolution < tiers[i-1].Resolution || t.Retention < tiers[i-1].Retention) {
+			return fmt.Errorf("tier %d: tiers must be ordered from finest to coarsest", i)
+		}
+	}
+	return nil
+}
+
+type bucket struct {
+	start int64 // unix nanoseconds, aligned to the ring resolution
+	sum   float64
+	min   float64
+	max   float64
+	count int
+}
+
+// ring holds the buckets of one tier in time order. Buckets are added as
+// values arrive and dropped once older than the retention, so a series
+// written only a few times holds only a few buckets.
+type ring struct {
+	resolution time.Duration
+	retention  time.Duration
+	buckets    []bucket
+}
+
+func newRing(t Tier) *ring {
+	return &ring{resolution: t.Resolution, retention: t.Retention}
+}
+
+func (r *ring) add(t time.Time, v float64) {
+	start := t.Truncate(r.resolution).UnixNano()
+
+	// Values normally arrive in order and land in the last bucket or a new
+	// one after it.
+	i := len(r.buckets)
+	if i == 0 || r.buckets[i-1].start < start {
+		r.buckets = append(r.buckets, bucket{start: start, min: v, max: v})
+	} else {
+		i = sort.Search(len(r.buckets), func(j int) bool { return r.buckets[j].start >= start })
+		if r.buckets[i].start != start {
+			r.buckets = append(r.buckets, bucket{})
+			copy(r.buckets[i+1:], r.buckets[i:])
+			r.buckets[i] = bucket{start: start, min: v, max: v}
+		}
+	}
+	b := &r.buckets[i]
+	b.sum += v
+	b.count++
+	b.min = math.Min(b.min, v)
+	b.max = math.Max(b.max, v)
+
+	r.expire(t)
+}
+
+// expire drops the buckets older than the retention before t.
+func (r *ring) expire(t time.Time) {
+	oldest := t.Add(-r.retention).UnixNano()
+	n := sort.Search(len(r.buckets), func(j int) bool { return r.buckets[j].start > oldest })
+	// The dropped buckets are released when append next reallocates.
+	r.buckets = r.buckets[n:]
+}
+
+// between returns the buckets starting within [from, to], oldest first.
+func (r *ring) between(from, to time.Time) []bucket {
+	lo := sort.Search(len(r.buckets), func(j int) bool { return r.buckets[j].start >= from.UnixNano() })
+	hi := sort.Search(len(r.buckets), func(j int) bool { return r.buckets[j].start > to.UnixNano() })
+	if lo >= hi {
+		return nil
+	}
+	return r.buckets[lo:hi]
+}
+
+type series struct {
+	name    string
+	labels  map[string]string
+	rings   []*ring
+	written time.Time
+}
+
+type counterState struct {
+	value float64
+	time  time.Time
+}
+
+// Store is an in-memory time-series store with tiered retention. Series
+// not written for longer than the longest retention are evicted, so
+// cgroups, devices and other sources that come and go do not accumulate.
+//
+// At most maxSeries series are kept. Points of new series are dropped
+// while the store is full, which is logged once each time it fills up.
+type Store struct {
+	mu        sync.RWMutex
+	tiers     []Tier
+	maxSeries int
+	series    map[string]*series
+	counters  map[string]counterState
+	evicted   time.Time
+	full      bool
+	dropped   uint64
+}
+
+func New(tiers []Tier, maxSeries int) (*Store, error) {
+	if err := validateTiers(tiers); err != nil {
+		return nil, err
+	}
+	if maxSeries <= 0 {
+		return nil, errors.New("max series must be positive")
+	}
+	return &Store{
+		tiers:     tiers,
+		maxSeries: maxSeries,
+		series:    make(map[string]*series),
+		counters:  make(map[string]counterState),
+	}, nil
+}
+
+// Record stores points taken at t. Counter points are stored as per-second
+// rates under "<name>_per_second", starting from their second sample.
+func (s *Store) Record(t time.Time, points []metric.Point) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, p := range points {
+		name, value := p.Name, p.Value
+		if p.Counter {
+			key := metric.Key(p.Name, p.Labels)
+			prev, ok := s.counters[key]
+			s.counters[key] = counterState{value: p.Value, time: t}
+			elapsed := t.Sub(prev.time).Seconds()
+			if !ok || elapsed <= 0 || p.Value < prev.value {
+				continue
+			}
+			name, value = p.Name+"_per_second", (p.Value-prev.value)/elapsed
+		}
+
+		key := metric.Key(name, p.Labels)
+		ser, ok := s.series[key]
+		if !ok && len(s.series) >= s.maxSeries {
+			if !s.full {
+				log.Printf("History holds the maximum of %d series, dropping points of new series such as %s", s.maxSeries, key)
+				s.full = true
+			}
+			s.dropped++
+			continue
+		}
+		if !ok {
+			labels := p.Labels
+			if labels == nil {
+				labels = map[string]string{}
+			}
+			ser = &series{name: name, labels: labels}
+			for _, tier := range s.tiers {
+				ser.rings = append(ser.rings, newRing(tier))
+			}
+			s.series[key] = ser
+		}
+		for _, r := range ser.rings {
+			r.add(t, value)
+		}
+		ser.written = t
+	}
+
+	s.evict(t)
+}
+
+// evict removes the series and counters not written for longer than the
+// longest retention before t. It runs at most once per finest resolution.
+// The caller holds s.mu.
+func (s *Store) evict(t time.Time) {
+	if t.Sub(s.evicted) < s.tiers[0].Resolution {
+		return
+	}
+	s.evicted = t
+
+	oldest := t.Add(-s.tiers[len(s.tiers)-1].Retention)
+	for key, ser := range s.series {
+		if ser.written.Before(oldest) {
+			delete(s.series, key)
+		}
+	}
+	if len(s.series) < s.maxSeries {
+		s.full = false
+	}
+	for key, c := range s.counters {
+		if c.time.Before(oldest) {
+			delete(s.counters, key)
+		}
+	}
+}
+
+// Stats describes how full the store is. DroppedPoints counts the points
+// of new series dropped because the store was full.
+type Stats struct {
+	Series        int    `json:"series"`
+	MaxSeries     int    `json:"max_series"`
+	DroppedPoints uint64 `json:"dropped_points"`
+}
+
+func (s *Store) Stats() Stats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return Stats{Series: len(s.series), MaxSeries: s.maxSeries, DroppedPoints: s.dropped}
+}
+
+// Metrics returns the names of all recorded metrics, sorted.
+func (s *Store) Metrics() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	var names []string
+	for _, ser := range s.series {
+		if !seen[ser.name] {
+			seen[ser.name] = true
+			names = append(names, ser.name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Series is the result of a query for one label set. Each point is
+// [unix seconds, average value over the step].
+type Series struct {
+	Labels map[string]string `json:"labels"`
+	Points [][2]float64      `json:"points"`
+}
+
+// Result is the answer to a range query.
+type Result struct {
+	Metric string    `json:"metric"`
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	Step   string    `json:"step"`
+	Series []Series  `json:"series"`
+}
+
+var ErrUnknownMetric = errors.New("unknown metric")
+
+// Query returns the series of name matching selector between from and to,
+// averaged over windows of step. The finest tier still holding from is
+// used, and step is raised to that tier's resolution if needed.
+func (s *Store) Query(name string, selector map[string]string, from, to time.Time, step time.Duration) (Result, error) {
+	if !from.Before(to) {
+		return Result{}, errors.New("from must be before to")
+	}
+
+	tier := len(s.tiers) - 1
+	for i, t := range s.tiers {
+		// Allow one bucket of slack for relative queries like from=-1h.
+		if time.Since(from) <= t.Retention+t.Resolution {
+			tier = i
+			break
+		}
+	}
+	if step < s.tiers[tier].Resolution {
+		step = s.tiers[tier].Resolution
+	}
+	if to.Sub(from)/step > maxPoints {
+		return Result{}, fmt.Errorf("query would return more than %d points per series, increase step", maxPoints)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := Result{Metric: name, From: from, To: to, Step: step.String(), Series: []Series{}}
+	found := false
+	for _, ser := range s.series {
+		if ser.name != name {
+			continue
+		}
+		found = true
+		if !metric.Matches(ser.labels, selector) {
+			continue
+		}
+
+		result.Series = append(result.Series, Series{
+			Labels: ser.labels,
+			Points: downsample(ser.rings[tier].between(from, to), step),
+		})
+	}
+	if !found {
+		return Result{}, ErrUnknownMetric
+	}
+
+	sort.Slice(result.Series, func(i, j int) bool {
+		return metric.Key(name, result.Series[i].Labels) < metric.Key(name, result.Series[j].Labels)
+	})
+	return result, nil
+}
+
+// downsample merges ordered buckets into windows of step.
+func downsample(buckets []bucket, step time.Duration) [][2]float64 {
+	points := [][2]float64{}
+	var window int64 = -1
+	var sum float64
+	var count int
+
+	flush := func() {
+		if count > 0 {
+			points = append(points, [2]float64{float64(window) / 1e9, sum / float64(count)})
+		}
+	}
+
+	for _, b := range buckets {
+		start := b.start - b.start%int64(step)
+		if start != window {
+			flush()
+			window, sum, count = start, 0, 0
+		}
+		sum += b.sum
+		count += b.count
+	}
+	flush()
+	return points
+}
@@ -1,6 +1,7 @@
 package systeminfo
 
 import (
+	"context"
 	"net/http"
 	"runtime"
 
@@ -8,42 +9,55 @@ import (
 	"github.com/shirou/gopsutil/v4/host"
 )
 
-func GetSystemInfo(c *gin.Context) {
-	sysInfoChan := make(chan *host.InfoStat)
-	errChan := make(chan error)
+// Snapshot describes the host and its current uptime and users.
+type Snapshot struct {
+	System        string          `json:"system"`
+	Hostname      string          `json:"hostname"`
+	Platform      string          `json:"platform"`
+	Version       string          `json:"version"`
+	Arch          string          `json:"arch"`
+	BootTime      uint64          `json:"boot_time"`
+	Uptime        uint64          `json:"uptime"`
+	Users         []host.UserStat `json:"users"`
+	KernelArch    string          `json:"kernel_arch"`
+	KernelVersion string          `json:"kernel_version"`
+	HostID        string          `json:"host_id"`
+}
+
+// Collect gathers host identification, uptime and logged-in users.
+func Collect(ctx context.Context) (Snapshot, error) {
+	sysInfo, err := host.InfoWithContext(ctx)
+	if err != nil {
+		return Snapshot{}, err
+	}
 
-	go func() {
-		sysInfo, err := host.Info()
-		if err != nil {
-			errChan <- err
-			return
-		}
-		sysInfoChan <- sysInfo
-	}()
+	bootTime, _ := host.BootTimeWithContext(ctx)
+	uptime, _ := host.UptimeWithContext(ctx)
+	users, _ := host.UsersWithContext(ctx)
+	kernelArch, _ := host.KernelArch()
+	kernelVersion, _ := host.KernelVersionWithContext(ctx)
+	hostID, _ := host.HostIDWithContext(ctx)
 
-	select {
-	case sysInfo := <-sysInfoChan:
-		bootTime, _ := host.BootTime()
-		uptime, _ := host.Uptime()
-		users, _ := host.Users()
-		kernelArch, _ := host.KernelArch()
-		kernelVersion, _ := host.KernelVersion()
-		hostID, _ := host.HostID()
+	return Snapshot{
+		System:        sysInfo.OS,
+		Hostname:      sysInfo.Hostname,
+		Platform:      sysInfo.Platform,
+		Version:       sysInfo.PlatformVersion,
+		Arch:          runtime.GOARCH,
+		BootTime:      bootTime,
+		Uptime:        uptime,
+		Users:         users,
+		KernelArch:    kernelArch,
+		KernelVersion: kernelVersion,
+		HostID:        hostID,
+	}, nil
+}
 
-		c.JSON(http.StatusOK, gin.H{
-			"system":         sysInfo.OS,
-			"hostname":       sysInfo.Hostname,
-			"platform":       sysInfo.Platform,
-			"version":        sysInfo.PlatformVersion,
-			"arch":           runtime.GOARCH,
-			"boot_time":      bootTime,
-			"uptime":         uptime,
-			"users":          users,
-			"kernel_arch":    kernelArch,
-			"kernel_version": kernelVersion,
-			"host_id":        hostID,
-		})
-	case err := <-errChan:
+func GetSystemInfo(c *gin.Context) {
+	snap, err := Collect(c.Request.Context())
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
+	c.JSON(http.StatusOK, snap)
 }
@@ -1,19 +1,68 @@
 package memoryinfo
 
 import (
+	"context"
 	"net/http"
+	"os"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/shirou/gopsutil/v4/host"
 	"github.com/shirou/gopsutil/v4/mem"
 )
 
-func GetMemoryInfo(c *gin.Context) {
-	memInfoChan := make(chan *mem.VirtualMemoryStat)
-	swapInfoChan := make(chan *mem.SwapMemoryStat)
-	errChan := make(chan error)
+// Snapshot is a point-in-time view of memory and swap usage, in bytes.
+// The breakdown from buffers on is only filled in on Linux, where Paging
+// is also available.
+type Snapshot struct {
+	TotalMemory       uint64  `json:"total_memory"`
+	AvailableMemory   uint64  `json:"available_memory"`
+	UsedMemory        uint64  `json:"used_memory"`
+	FreeMemory        uint64  `json:"free_memory"`
+	UsedMemoryPercent float64 `json:"used_memory_percent"`
+	TotalSwap         uint64  `json:"total_swap"`
+	UsedSwap          uint64  `json:"used_swap"`
+	FreeSwap          uint64  `json:"free_swap"`
+	UsedSwapPercent   float64 `json:"used_swap_percent"`
+
+	Buffers           uint64 `json:"buffers"`
+	Cached            uint64 `json:"cached"`
+	Shared            uint64 `json:"shared"`
+	Slab              uint64 `json:"slab"`
+	SlabReclaimable   uint64 `json:"slab_reclaimable"`
+	SlabUnreclaimable uint64 `json:"slab_unreclaimable"`
+	Dirty             uint64 `json:"dirty"`
+	Writeback         uint64 `json:"writeback"`
+	// Huge page counts are in pages of HugePageSize bytes.
+	HugePagesTotal    uint64 `json:"hugepages_total"`
+	HugePagesFree     uint64 `json:"hugepages_free"`
+	HugePagesReserved uint64 `json:"hugepages_reserved"`
+	HugePagesSurplus  uint64 `json:"hugepages_surplus"`
+	HugePageSize      uint64 `json:"hugepage_size"`
+	// CommittedAS is the memory allocated by all processes, which can
+	// exceed CommitLimit unless overcommit is disabled.
+	CommittedAS      uint64  `json:"committed_as"`
+	CommitLimit      uint64  `json:"commit_limit"`
+	CommittedPercent float64 `json:"committed_percent"`
+
+	Paging *Paging `json:"paging,omitempty"`
+}
+
+// Collect gathers virtual memory and swap usage with the default
+// collector.
+func Collect(ctx context.Context) (Snapshot, error) {
+	return defaultCollector.Collect(ctx)
+}
+
+// Collect gathers virtual memory and swap usage, with paging rates
+// relative to the previous call.
+func (c *Collector) Collect(ctx context.Context) (Snapshot, error) {
+	memInfoChan := make(chan *mem.VirtualMemoryStat, 1)
+	swapInfoChan := make(chan *mem.SwapMemoryStat, 1)
+	errChan := make(chan error, 2)
 
 	go func() {
-		memInfo, err := mem.VirtualMemory()
+		memInfo, err := mem.VirtualMemoryWithContext(ctx)
 		if err != nil {
 			errChan <- err
 			return
@@ -22,7 +71,7 @@ func GetMemoryInfo(c *gin.Context) {
 	}()
 
 	go func() {
-		swapInfo, err := mem.SwapMemory()
+		swapInfo, err := mem.SwapMemoryWithContext(ctx)
 		if err != nil {
 			errChan <- err
 			return
@@ -30,25 +79,62 @@ func GetMemoryInfo(c *gin.Context) {
 		swapInfoChan <- swapInfo
 	}()
 
-	select {
-	case memInfo := <-memInfoChan:
+	var memInfo *mem.VirtualMemoryStat
+	var swapInfo *mem.SwapMemoryStat
+	for memInfo == nil || swapInfo == nil {
 		select {
-		case swapInfo := <-swapInfoChan:
-			c.JSON(http.StatusOK, gin.H{
-				"total_memory":        memInfo.Total,
-				"available_memory":    memInfo.Available,
-				"used_memory":         memInfo.Used,
-				"free_memory":         memInfo.Free,
-				"used_memory_percent": memInfo.UsedPercent,
-				"total_swap":          swapInfo.Total,
-				"used_swap":           swapInfo.Used,
-				"free_swap":           swapInfo.Free,
-				"used_swap_percent":   swapInfo.UsedPercent,
-			})
+		case memInfo = <-memInfoChan:
+		case swapInfo = <-swapInfoChan:
 		case err := <-errChan:
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return Snapshot{}, err
+		}
+	}
+
+	snap := Snapshot{
+		TotalMemory:       memInfo.Total,
+		AvailableMemory:   memInfo.Available,
+		UsedMemory:        memInfo.Used,
+		FreeMemory:        memInfo.Free,
+		UsedMemoryPercent: memInfo.UsedPercent,
+		TotalSwap:         swapInfo.Total,
+		UsedSwap:          swapInfo.Used,
+		FreeSwap:          swapInfo.Free,
+		UsedSwapPercent:   swapInfo.UsedPercent,
+		Buffers:           memInfo.Buffers,
+		Cached:            memInfo.Cached,
+		Shared:            memInfo.Shared,
+		Slab:              memInfo.Slab,
+		SlabReclaimable:   memInfo.Sreclaimable,
+		SlabUnreclaimable: memInfo.Sunreclaim,
+		Dirty:             memInfo.Dirty,
+		Writeback:         memInfo.WriteBack,
+		HugePagesTotal:    memInfo.HugePagesTotal,
+		HugePagesFree:     memInfo.HugePagesFree,
+		HugePagesReserved: memInfo.HugePagesRsvd,
+		HugePagesSurplus:  memInfo.HugePagesSurp,
+		HugePageSize:      memInfo.HugePageSize,
+		CommittedAS:       memInfo.CommittedAS,
+		CommitLimit:       memInfo.CommitLimit,
+	}
+	if memInfo.CommitLimit > 0 {
+		snap.CommittedPercent = float64(memInfo.CommittedAS) / float64(memInfo.CommitLimit) * 100
+	}
+
+	if vmstat, err := ReadVMStat(); err == nil {
+		uptime, err := host.UptimeWithContext(ctx)
+		if err != nil {
+			return Snapshot{}, err
 		}
-	case err := <-errChan:
+		snap.Paging = c.paging(vmstat, time.Duration(uptime)*time.Second, os.Getpagesize())
+	}
+	return snap, nil
+}
+
+func GetMemoryInfo(c *gin.Context) {
+	snap, err := Collect(c.Request.Context())
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
+	c.JSON(http.StatusOK, snap)
 }
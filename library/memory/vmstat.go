@@ -0,0 +1,93 @@
+package memoryinfo
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Paging is swap, page fault and OOM killer activity from /proc/vmstat.
+// The counters are since boot; the rates cover the window before the
+// collection.
+type Paging struct {
+	SwapIn      uint64 `json:"swap_in_pages"`
+	SwapOut     uint64 `json:"swap_out_pages"`
+	PageFaults  uint64 `json:"page_faults"`
+	MajorFaults uint64 `json:"major_faults"`
+	OOMKills    uint64 `json:"oom_kills"`
+
+	SwapInBytesPerSecond  float64 `json:"swap_in_bytes_per_second"`
+	SwapOutBytesPerSecond float64 `json:"swap_out_bytes_per_second"`
+	PageFaultsPerSecond   float64 `json:"page_faults_per_second"`
+	MajorFaultsPerSecond  float64 `json:"major_faults_per_second"`
+	Window                float64 `json:"window_seconds"`
+}
+
+// ParseVMStat parses the "name value" lines of /proc/vmstat, skipping
+// lines whose value is not a number.
+func ParseVMStat(data string) map[string]uint64 {
+	vmstat := make(map[string]uint64)
+	for _, line := range strings.Split(data, "\n") {
+		name, value, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		if n, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64); err == nil {
+			vmstat[name] = n
+		}
+	}
+	return vmstat
+}
+
+// Collector keeps the vmstat counters of the previous collection to
+// compute paging rates from.
+type Collector struct {
+	mu       sync.Mutex
+	prev     map[string]uint64
+	prevTime time.Time
+}
+
+var defaultCollector = NewCollector()
+
+func NewCollector() *Collector {
+	return &Collector{}
+}
+
+// paging computes the paging counters and rates from the current vmstat
+// counters. The first call has no previous counters and covers the time
+// since boot.
+func (c *Collector) paging(vmstat map[string]uint64, uptime time.Duration, pageSize int) *Paging {
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	prev, prevTime := c.prev, c.prevTime
+	if prev == nil {
+		prev, prevTime = map[string]uint64{}, now.Add(-uptime)
+	}
+	c.prev, c.prevTime = vmstat, now
+
+	window := now.Sub(prevTime).Seconds()
+	rate := func(key string) float64 {
+		cur, last := vmstat[key], prev[key]
+		if window <= 0 || cur < last {
+			return 0
+		}
+		return float64(cur-last) / window
+	}
+
+	return &Paging{
+		SwapIn:                vmstat["pswpin"],
+		SwapOut:               vmstat["pswpout"],
+		PageFaults:            vmstat["pgfault"],
+		MajorFaults:           vmstat["pgmajfault"],
+		OOMKills:              vmstat["oom_kill"],
+		SwapInBytesPerSecond:  rate("pswpin") * float64(pageSize),
+		SwapOutBytesPerSecond: rate("pswpout") * float64(pageSize),
+		PageFaultsPerSecond:   rate("pgfault"),
+		MajorFaultsPerSecond:  rate("pgmajfault"),
+		Window:                window,
+	}
+}
@@ -0,0 +1,12 @@
+package memoryinfo
+
+import "os"
+
+// ReadVMStat returns the counters in /proc/vmstat by name.
+func ReadVMStat() (map[string]uint64, error) {
+	data, err := os.ReadFile("/proc/vmstat")
+	if err != nil {
+		return nil, err
+	}
+	return ParseVMStat(string(data)), nil
+}
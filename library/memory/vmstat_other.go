@@ -0,0 +1,10 @@
+//go:build !linux
+
+package memoryinfo
+
+import "errors"
+
+// ReadVMStat is only supported on Linux.
+func ReadVMStat() (map[string]uint64, error) {
+	return nil, errors.New("vmstat is only available on Linux")
+}
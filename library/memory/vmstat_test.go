@@ -0,0 +1,65 @@
+package memoryinfo
+
+import (
+	"math"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func readVMStatFixture(t *testing.T) map[string]uint64 {
+	t.Helper()
+	data, err := os.ReadFile("testdata/vmstat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ParseVMStat(string(data))
+}
+
+func TestParseVMStat(t *testing.T) {
+	want := map[string]uint64{
+		"nr_free_pages":           841396,
+		"nr_zone_inactive_anon":   12345,
+		"workingset_refault_anon": 0,
+		"pswpin":                  100,
+		"pswpout":                 250,
+		"pgfault":                 25737640,
+		"pgmajfault":              801,
+		"oom_kill":                3,
+	}
+	if got := readVMStatFixture(t); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseVMStat = %v, want %v", got, want)
+	}
+}
+
+func TestPaging(t *testing.T) {
+	vmstat := readVMStatFixture(t)
+	c := NewCollector()
+
+	first := c.paging(vmstat, 100*time.Second, 4096)
+	if first.SwapIn != 100 || first.SwapOut != 250 || first.PageFaults != 25737640 || first.MajorFaults != 801 || first.OOMKills != 3 {
+		t.Errorf("counters = %+v", first)
+	}
+	// The first collection covers the time since boot.
+	if math.Abs(first.Window-100) > 1 || math.Abs(first.SwapOutBytesPerSecond-250*4096/first.Window) > 1e-6 {
+		t.Errorf("first window = %v, swap out rate = %v", first.Window, first.SwapOutBytesPerSecond)
+	}
+
+	next := map[string]uint64{"pswpin": 100, "pswpout": 260, "pgfault": 25737740, "pgmajfault": 700}
+	c.prevTime = time.Now().Add(-10 * time.Second)
+	second := c.paging(next, 0, 4096)
+	if math.Abs(second.Window-10) > 1 {
+		t.Fatalf("second window = %v, want about 10s", second.Window)
+	}
+	if got, want := second.SwapOutBytesPerSecond, 10*4096/second.Window; math.Abs(got-want) > 1e-6 {
+		t.Errorf("swap out rate = %v, want %v", got, want)
+	}
+	if got, want := second.PageFaultsPerSecond, 100/second.Window; math.Abs(got-want) > 1e-6 {
+		t.Errorf("page fault rate = %v, want %v", got, want)
+	}
+	// A counter that went backwards, e.g. after a wrap, has no rate.
+	if second.MajorFaultsPerSecond != 0 || second.SwapInBytesPerSecond != 0 {
+		t.Errorf("major fault rate = %v, swap in rate = %v, want 0", second.MajorFaultsPerSecond, second.SwapInBytesPerSecond)
+	}
+}
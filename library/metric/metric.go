@@ -0,0 +1,384 @@
+package metric
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	cgroupinfo "checker/library/cgroup"
+	cpuinfo "checker/library/cpu"
+	diskinfo "checker/library/disk"
+	memoryinfo "checker/library/memory"
+	networkinfo "checker/library/network"
+	"checker/library/oom"
+	pressureinfo "checker/library/pressure"
+	sensorinfo "checker/library/sensor"
+	"checker/library/watch"
+)
+
+// Point is a single numeric value extracted from a collector snapshot.
+// Names are "<collector>.<field>", using the JSON field names of the
+// snapshot, e.g. "memory.used_memory_percent" or "disk.used_percent".
+type Point struct {
+	Name   string
+	Labels map[string]string
+	Value  float64
+	// Counter marks monotonically increasing values; consumers usually
+	// turn these into per-second rates.
+	Counter bool
+}
+
+// Key returns a canonical identifier for a series, e.g.
+// disk.used_percent{mountpoint="/"}.
+func Key(name string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return name
+	}
+
+	names := make([]string, 0, len(labels))
+	for k := range labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteByte('{')
+	for i, k := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(k + "=" + strconv.Quote(labels[k]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// Matches reports whether labels contain every pair in selector.
+func Matches(labels, selector map[string]string) bool {
+	for k, v := range selector {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Extract returns the points of any known snapshot type.
+func Extract(data interface{}) []Point {
+	switch snap := data.(type) {
+	case cpuinfo.Snapshot:
+		return cpuPoints(snap)
+	case memoryinfo.Snapshot:
+		return memoryPoints(snap)
+	case diskinfo.Snapshot:
+		return diskPoints(snap)
+	case diskinfo.IOSnapshot:
+		return diskIOPoints(snap)
+	case networkinfo.Snapshot:
+		return networkPoints(snap)
+	case sensorinfo.Snapshot:
+		return sensorPoints(snap)
+	case watch.Snapshot:
+		return watchPoints(snap)
+	case cgroupinfo.Snapshot:
+		return cgroupPoints(snap)
+	case pressureinfo.Snapshot:
+		return pressurePoints("pressure", snap, nil, true)
+	case oom.Snapshot:
+		return oomPoints(snap)
+	}
+	return nil
+}
+
+func cpuPoints(snap cpuinfo.Snapshot) []Point {
+	points := make([]Point, 0, len(snap.PercentPerCore)+14)
+
+	for i, p := range snap.PercentPerCore {
+		points = append(points, Point{
+			Name:   "cpu.percent_per_core",
+			Labels: map[string]string{"cpu": strconv.Itoa(i)},
+			Value:  p,
+		})
+	}
+	points = append(points,
+		Point{Name: "cpu.percent", Value: snap.Percent},
+		Point{Name: "cpu.user_percent", Value: snap.Usage.User},
+		Point{Name: "cpu.system_percent", Value: snap.Usage.System},
+		Point{Name: "cpu.iowait_percent", Value: snap.Usage.Iowait},
+		Point{Name: "cpu.steal_percent", Value: snap.Usage.Steal},
+	)
+
+	if l := snap.Load; l != nil {
+		points = append(points,
+			Point{Name: "cpu.load1", Value: l.Load1},
+			Point{Name: "cpu.load5", Value: l.Load5},
+			Point{Name: "cpu.load15", Value: l.Load15},
+			Point{Name: "cpu.run_queue", Value: float64(l.Running)},
+		)
+	}
+	if snap.Topology != nil {
+		for _, c := range snap.Topology.CPUs {
+			labels := map[string]string{"cpu": strconv.Itoa(c.CPU)}
+			if c.Frequency != nil {
+				points = append(points, Point{Name: "cpu.frequency_mhz", Labels: labels, Value: c.Frequency.CurrentMHz})
+			}
+			if c.Throttle != nil {
+				points = append(points,
+					Point{Name: "cpu.core_throttle_count", Labels: labels, Value: float64(c.Throttle.CoreCount), Counter: true},
+					Point{Name: "cpu.package_throttle_count", Labels: labels, Value: float64(c.Throttle.PackageCount), Counter: true},
+				)
+			}
+		}
+	}
+	if st := snap.Stats; st != nil {
+		points = append(points,
+			Point{Name: "cpu.ctx_switches", Value: float64(st.ContextSwitches), Counter: true},
+			Point{Name: "cpu.interrupts", Value: float64(st.Interrupts), Counter: true},
+			Point{Name: "cpu.soft_interrupts", Value: float64(st.SoftInterrupts), Counter: true},
+			Point{Name: "cpu.procs_running", Value: float64(st.ProcsRunning)},
+			Point{Name: "cpu.procs_blocked", Value: float64(st.ProcsBlocked)},
+		)
+	}
+	return points
+}
+
+func memoryPoints(snap memoryinfo.Snapshot) []Point {
+	points := []Point{
+		{Name: "memory.total_memory", Value: float64(snap.TotalMemory)},
+		{Name: "memory.available_memory", Value: float64(snap.AvailableMemory)},
+		{Name: "memory.used_memory", Value: float64(snap.UsedMemory)},
+		{Name: "memory.free_memory", Value: float64(snap.FreeMemory)},
+		{Name: "memory.used_memory_percent", Value: snap.UsedMemoryPercent},
+		{Name: "memory.total_swap", Value: float64(snap.TotalSwap)},
+		{Name: "memory.used_swap", Value: float64(snap.UsedSwap)},
+		{Name: "memory.free_swap", Value: float64(snap.FreeSwap)},
+		{Name: "memory.used_swap_percent", Value: snap.UsedSwapPercent},
+		{Name: "memory.buffers", Value: float64(snap.Buffers)},
+		{Name: "memory.cached", Value: float64(snap.Cached)},
+		{Name: "memory.shared", Value: float64(snap.Shared)},
+		{Name: "memory.slab", Value: float64(snap.Slab)},
+		{Name: "memory.slab_reclaimable", Value: float64(snap.SlabReclaimable)},
+		{Name: "memory.slab_unreclaimable", Value: float64(snap.SlabUnreclaimable)},
+		{Name: "memory.dirty", Value: float64(snap.Dirty)},
+		{Name: "memory.writeback", Value: float64(snap.Writeback)},
+		{Name: "memory.committed_percent", Value: snap.CommittedPercent},
+	}
+	if p := snap.Paging; p != nil {
+		points = append(points,
+			Point{Name: "memory.swap_in_bytes_per_second", Value: p.SwapInBytesPerSecond},
+			Point{Name: "memory.swap_out_bytes_per_second", Value: p.SwapOutBytesPerSecond},
+			Point{Name: "memory.page_faults_per_second", Value: p.PageFaultsPerSecond},
+			Point{Name: "memory.major_faults_per_second", Value: p.MajorFaultsPerSecond},
+			Point{Name: "memory.oom_kills", Value: float64(p.OOMKills), Counter: true},
+		)
+	}
+	return points
+}
+
+func diskPoints(snap diskinfo.Snapshot) []Point {
+	var points []Point
+	seen := make(map[string]bool)
+	for _, p := range snap.Partitions {
+		labels := map[string]string{"device": p.Device, "mountpoint": p.Mountpoint}
+		if p.Error != "" {
+			points = append(points, Point{Name: "disk.error", Labels: labels, Value: 1})
+		} else {
+			points = append(points,
+				Point{Name: "disk.error", Labels: labels, Value: 0},
+				Point{Name: "disk.total_space", Labels: labels, Value: float64(p.TotalSpace)},
+				Point{Name: "disk.used_space", Labels: labels, Value: float64(p.UsedSpace)},
+				Point{Name: "disk.free_space", Labels: labels, Value: float64(p.FreeSpace)},
+				Point{Name: "disk.used_percent", Labels: labels, Value: p.UsedPercent},
+			)
+		}
+
+		// IO counters belong to the device, which can be mounted more than once.
+		if seen[p.Device] {
+			continue
+		}
+		seen[p.Device] = true
+		device := map[string]string{"device": p.Device}
+		points = append(points,
+			Point{Name: "disk.io_read_count", Labels: device, Value: float64(p.IOReadCount), Counter: true},
+			Point{Name: "disk.io_write_count", Labels: device, Value: float64(p.IOWriteCount), Counter: true},
+			Point{Name: "disk.io_read_bytes", Labels: device, Value: float64(p.IOReadBytes), Counter: true},
+			Point{Name: "disk.io_write_bytes", Labels: device, Value: float64(p.IOWriteBytes), Counter: true},
+		)
+	}
+	return points
+}
+
+func diskIOPoints(snap diskinfo.IOSnapshot) []Point {
+	points := make([]Point, 0, len(snap.Devices)*10)
+	for _, d := range snap.Devices {
+		labels := map[string]string{"device": d.Device}
+		points = append(points,
+			Point{Name: "diskio.read_iops", Labels: labels, Value: d.ReadIOPS},
+			Point{Name: "diskio.write_iops", Labels: labels, Value: d.WriteIOPS},
+			Point{Name: "diskio.read_bytes_per_second", Labels: labels, Value: d.ReadBytesPerSecond},
+			Point{Name: "diskio.write_bytes_per_second", Labels: labels, Value: d.WriteBytesPerSecond},
+			Point{Name: "diskio.read_await_ms", Labels: labels, Value: d.ReadAwaitMs},
+			Point{Name: "diskio.write_await_ms", Labels: labels, Value: d.WriteAwaitMs},
+			Point{Name: "diskio.await_ms", Labels: labels, Value: d.AwaitMs},
+			Point{Name: "diskio.queue_depth", Labels: labels, Value: d.QueueDepth},
+			Point{Name: "diskio.in_flight", Labels: labels, Value: float64(d.InFlight)},
+			Point{Name: "diskio.util_percent", Labels: labels, Value: d.UtilPercent},
+		)
+	}
+	return points
+}
+
+func networkPoints(snap networkinfo.Snapshot) []Point {
+	var points []Point
+	for _, nic := range snap.NicIOCounters {
+		labels := map[string]string{"interface": nic.Name}
+		points = append(points,
+			Point{Name: "network.bytes_sent", Labels: labels, Value: float64(nic.BytesSent), Counter: true},
+			Point{Name: "network.bytes_recv", Labels: labels, Value: float64(nic.BytesRecv), Counter: true},
+			Point{Name: "network.packets_sent", Labels: labels, Value: float64(nic.PacketsSent), Counter: true},
+			Point{Name: "network.packets_recv", Labels: labels, Value: float64(nic.PacketsRecv), Counter: true},
+			Point{Name: "network.errin", Labels: labels, Value: float64(nic.Errin), Counter: true},
+			Point{Name: "network.errout", Labels: labels, Value: float64(nic.Errout), Counter: true},
+		)
+	}
+	return points
+}
+
+func sensorPoints(snap sensorinfo.Snapshot) []Point {
+	points := make([]Point, 0, len(snap.SensorTemperatures))
+	for _, t := range snap.SensorTemperatures {
+		points = append(points, Point{
+			Name:   "sensor.temperature",
+			Labels: map[string]string{"sensor": t.SensorKey},
+			Value:  t.Temperature,
+		})
+	}
+	return points
+}
+
+// watchPoints include watch.running as 0 or 1, so a rule such as
+// watch.running{watch="nginx"} < 1 alerts on a missing process.
+func watchPoints(snap watch.Snapshot) []Point {
+	var points []Point
+	for _, st := range snap.Watches {
+		labels := map[string]string{"watch": st.Name}
+		running := 0.0
+		if st.Running {
+			running = 1
+		}
+		points = append(points,
+			Point{Name: "watch.running", Labels: labels, Value: running},
+			Point{Name: "watch.instances", Labels: labels, Value: float64(st.Instances)},
+			Point{Name: "watch.restarts", Labels: labels, Value: float64(st.Restarts)},
+			Point{Name: "watch.cpu_percent", Labels: labels, Value: st.CPUPercent},
+			Point{Name: "watch.rss", Labels: labels, Value: float64(st.RSS)},
+		)
+	}
+	return points
+}
+
+// CgroupDepth is the deepest cgroup below the root, e.g. 1 for
+// /system.slice, whose points are extracted. Container cgroups are
+// extracted at any depth. Deeper cgroups are only served by the cgroup
+// and Prometheus endpoints.
+var CgroupDepth = 1
+
+// cgroupDepth returns the number of path elements below the root.
+func cgroupDepth(path string) int {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return 0
+	}
+	return strings.Count(path, "/") + 1
+}
+
+// cgroupPoints are labeled by cgroup path, and by container ID for
+// container cgroups. Of the pressure, only the 10 second averages and the
+// totals are extracted.
+func cgroupPoints(snap cgroupinfo.Snapshot) []Point {
+	var points []Point
+	for _, cg := range snap.Cgroups {
+		if cg.ContainerID == "" && cgroupDepth(cg.Path) > CgroupDepth {
+			continue
+		}
+		labels := map[string]string{"cgroup": cg.Path}
+		if cg.ContainerID != "" {
+			labels["container_id"] = cg.ContainerID
+		}
+		if cg.CPU != nil {
+			points = append(points,
+				Point{Name: "cgroup.cpu_usage_usec", Labels: labels, Value: float64(cg.CPU.UsageUsec), Counter: true},
+				Point{Name: "cgroup.cpu_nr_throttled", Labels: labels, Value: float64(cg.CPU.NrThrottled), Counter: true},
+				Point{Name: "cgroup.cpu_throttled_usec", Labels: labels, Value: float64(cg.CPU.ThrottledUsec), Counter: true},
+			)
+		}
+		if cg.Memory != nil {
+			points = append(points, Point{Name: "cgroup.memory_current", Labels: labels, Value: float64(cg.Memory.Current)})
+			if cg.Memory.Max != nil {
+				points = append(points, Point{Name: "cgroup.memory_max", Labels: labels, Value: float64(*cg.Memory.Max)})
+			}
+			if kills, ok := cg.Memory.Events["oom_kill"]; ok {
+				points = append(points, Point{Name: "cgroup.memory_oom_kill", Labels: labels, Value: float64(kills), Counter: true})
+			}
+		}
+		if cg.Pids != nil {
+			points = append(points, Point{Name: "cgroup.pids_current", Labels: labels, Value: float64(cg.Pids.Current)})
+		}
+		if cg.Pressure != nil {
+			points = append(points, pressurePoints("cgroup.pressure", *cg.Pressure, labels, false)...)
+		}
+	}
+	return points
+}
+
+// pressurePoints are named like pressure.some_avg10{resource="memory"},
+// with the total stall time in microseconds as a counter. The 60 and 300
+// second averages are only included with all.
+func pressurePoints(prefix string, snap pressureinfo.Snapshot, labels map[string]string, all bool) []Point {
+	var points []Point
+	for _, name := range pressureinfo.ResourceNames {
+		r := snap.Resource(name)
+		if r == nil {
+			continue
+		}
+		l := map[string]string{"resource": name}
+		for k, v := range labels {
+			l[k] = v
+		}
+		for _, kind := range []string{"some", "full"} {
+			a := r.Some
+			if kind == "full" {
+				a = r.Full
+			}
+			if a == nil {
+				continue
+			}
+			points = append(points,
+				Point{Name: prefix + "." + kind + "_avg10", Labels: l, Value: a.Avg10},
+				Point{Name: prefix + "." + kind + "_total", Labels: l, Value: float64(a.Total), Counter: true},
+			)
+			if all {
+				points = append(points,
+					Point{Name: prefix + "." + kind + "_avg60", Labels: l, Value: a.Avg60},
+					Point{Name: prefix + "." + kind + "_avg300", Labels: l, Value: a.Avg300},
+				)
+			}
+		}
+	}
+	return points
+}
+
+// oomPoints count the kills within oom.RecentWindow, so a rule such as
+// oom.system_kills > 0 fires on a kill and resolves once it ages out.
+func oomPoints(snap oom.Snapshot) []Point {
+	points := []Point{{Name: "oom.system_kills", Value: float64(snap.SystemKills)}}
+	for _, c := range snap.Cgroups {
+		labels := map[string]string{"cgroup": c.Cgroup}
+		if c.ContainerID != "" {
+			labels["container_id"] = c.ContainerID
+		}
+		points = append(points, Point{Name: "oom.cgroup_kills", Labels: labels, Value: float64(c.Kills)})
+	}
+	return points
+}
@@ -0,0 +1,97 @@
+package metric
+
+import (
+	"sort"
+	"testing"
+
+	cgroupinfo "checker/library/cgroup"
+	memoryinfo "checker/library/memory"
+	pressureinfo "checker/library/pressure"
+)
+
+// pointKeys returns the sorted keys of points.
+func pointKeys(points []Point) []string {
+	keys := make([]string, 0, len(points))
+	for _, p := range points {
+		keys = append(keys, Key(p.Name, p.Labels))
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestCgroupPointsDepth(t *testing.T) {
+	const id = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	snap := cgroupinfo.Snapshot{Version: 2, Cgroups: []cgroupinfo.Cgroup{
+		{Path: "/", Pids: &cgroupinfo.PidsStats{Current: 1}},
+		{Path: "/system.slice", Pids: &cgroupinfo.PidsStats{Current: 2}},
+		{Path: "/system.slice/sshd.service", Pids: &cgroupinfo.PidsStats{Current: 3}},
+		{Path: "/system.slice/docker-" + id + ".scope", ContainerID: id, Pids: &cgroupinfo.PidsStats{Current: 4}},
+	}}
+
+	for _, tt := range []struct {
+		depth int
+		want  []string
+	}{
+		{0, []string{"/", "/system.slice/docker-" + id + ".scope"}},
+		{1, []string{"/", "/system.slice", "/system.slice/docker-" + id + ".scope"}},
+		{2, []string{"/", "/system.slice", "/system.slice/docker-" + id + ".scope", "/system.slice/sshd.service"}},
+	} {
+		old := CgroupDepth
+		CgroupDepth = tt.depth
+		points := cgroupPoints(snap)
+		CgroupDepth = old
+
+		var got []string
+		for _, p := range points {
+			got = append(got, p.Labels["cgroup"])
+		}
+		sort.Strings(got)
+		if len(got) != len(tt.want) {
+			t.Errorf("depth %d: cgroups = %q, want %q", tt.depth, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("depth %d: cgroups = %q, want %q", tt.depth, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestCgroupPressurePoints(t *testing.T) {
+	pressure := pressureinfo.Snapshot{CPU: &pressureinfo.Resource{
+		Some: &pressureinfo.Averages{Avg10: 1, Avg60: 2, Avg300: 3, Total: 4},
+	}}
+	snap := cgroupinfo.Snapshot{Version: 2, Cgroups: []cgroupinfo.Cgroup{{Path: "/", Pressure: &pressure}}}
+
+	got := pointKeys(cgroupPoints(snap))
+	want := []string{
+		Key("cgroup.pressure.some_avg10", map[string]string{"cgroup": "/", "resource": "cpu"}),
+		Key("cgroup.pressure.some_total", map[string]string{"cgroup": "/", "resource": "cpu"}),
+	}
+	sort.Strings(want)
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("cgroup pressure points = %q, want %q", got, want)
+	}
+
+	if n := len(Extract(pressure)); n != 4 {
+		t.Errorf("system pressure points = %d, want the three averages and the total", n)
+	}
+}
+
+func TestMemoryPointsSlab(t *testing.T) {
+	points := Extract(memoryinfo.Snapshot{Slab: 300, SlabReclaimable: 200, SlabUnreclaimable: 100})
+	want := map[string]float64{"memory.slab": 300, "memory.slab_reclaimable": 200, "memory.slab_unreclaimable": 100}
+	for _, p := range points {
+		if v, ok := want[p.Name]; ok {
+			if p.Value != v {
+				t.Errorf("%s = %v, want %v", p.Name, p.Value, v)
+			}
+			delete(want, p.Name)
+		}
+	}
+	for name := range want {
+		t.Errorf("no %s point", name)
+	}
+}
@@ -1,6 +1,7 @@
 package networkinfo
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"sync"
@@ -54,74 +55,122 @@ func GetConntrackStats() ([]net.ConntrackStat, error) {
 	return conntrackStats, nil
 }
 
-func GetNetworkInfo(c *gin.Context) {
+// Snapshot is a point-in-time view of the network stack. Sources that
+// could not be read are left nil.
+type Snapshot struct {
+	Pids           []int32              `json:"pids,omitempty"`
+	Interfaces     []net.InterfaceStat  `json:"interfaces,omitempty"`
+	Connections    []net.ConnectionStat `json:"connections,omitempty"`
+	IOCounters     []net.IOCountersStat `json:"io_counters,omitempty"`
+	NicIOCounters  []net.IOCountersStat `json:"nic_io_counters,omitempty"`
+	ConntrackStats []net.ConntrackStat  `json:"conntrack_stats,omitempty"`
+}
+
+// Sections returns the snapshot in the list-of-objects shape served by
+// /metrics/network, one object per source that was read successfully.
+func (s Snapshot) Sections() []map[string]interface{} {
+	sections := make([]map[string]interface{}, 0, 5)
+	if s.Pids != nil {
+		sections = append(sections, map[string]interface{}{"pids": s.Pids})
+	}
+	if s.Interfaces != nil {
+		sections = append(sections, map[string]interface{}{"interfaces": s.Interfaces})
+	}
+	if s.Connections != nil {
+		sections = append(sections, map[string]interface{}{"connections": s.Connections})
+	}
+	if s.IOCounters != nil {
+		sections = append(sections, map[string]interface{}{"io_counters": s.IOCounters})
+	}
+	if s.ConntrackStats != nil {
+		sections = append(sections, map[string]interface{}{"conntrack_stats": s.ConntrackStats})
+	}
+	return sections
+}
+
+// Collect gathers pids, interfaces, connections, IO counters and conntrack
+// stats. Sources that fail are logged and left out.
+func Collect(ctx context.Context) (Snapshot, error) {
 	var wg sync.WaitGroup
-	infoCh := make(chan map[string]interface{})
-	networkInfo := make([]map[string]interface{}, 0)
+	var snap Snapshot
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		pids, err := net.Pids()
+		pids, err := net.PidsWithContext(ctx)
 		if err != nil {
 			log.Printf("Error getting PIDs: %v\n", err)
 			return
 		}
-		infoCh <- map[string]interface{}{"pids": pids}
+		snap.Pids = pids
 	}()
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		addrs, err := net.Interfaces()
+		addrs, err := net.InterfacesWithContext(ctx)
 		if err != nil {
 			log.Printf("Error getting interfaces: %v\n", err)
 			return
 		}
-		infoCh <- map[string]interface{}{"interfaces": addrs}
+		snap.Interfaces = addrs
 	}()
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		connections, err := net.Connections("inet")
+		connections, err := net.ConnectionsWithContext(ctx, "inet")
 		if err != nil {
 			log.Printf("Error getting connections: %v\n", err)
 			return
 		}
-		infoCh <- map[string]interface{}{"connections": connections}
+		snap.Connections = connections
 	}()
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		ioCounters, err := net.IOCounters(false)
+		ioCounters, err := net.IOCountersWithContext(ctx, false)
 		if err != nil {
 			log.Printf("Error getting IO counters: %v\n", err)
 			return
 		}
-		infoCh <- map[string]interface{}{"io_counters": ioCounters}
+		snap.IOCounters = ioCounters
 	}()
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		conntrackStats, err := net.ConntrackStats(true)
+		ioCounters, err := net.IOCountersWithContext(ctx, true)
 		if err != nil {
-			log.Printf("Error getting conntrack stats: %v\n", err)
+			log.Printf("Error getting IO counters: %v\n", err)
 			return
 		}
-		infoCh <- map[string]interface{}{"conntrack_stats": conntrackStats}
+		snap.NicIOCounters = ioCounters
 	}()
 
+	wg.Add(1)
 	go func() {
-		wg.Wait()
-		close(infoCh)
+		defer wg.Done()
+		conntrackStats, err := net.ConntrackStatsWithContext(ctx, true)
+		if err != nil {
+			log.Printf("Error getting conntrack stats: %v\n", err)
+			return
+		}
+		snap.ConntrackStats = conntrackStats
 	}()
 
-	for info := range infoCh {
-		networkInfo = append(networkInfo, info)
+	wg.Wait()
+
+	return snap, nil
+}
+
+func GetNetworkInfo(c *gin.Context) {
+	snap, err := Collect(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
-	c.JSON(http.StatusOK, networkInfo)
+	c.JSON(http.StatusOK, snap.Sections())
 }
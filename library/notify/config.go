@@ -0,0 +1,157 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ReceiverConfig names one destination. Exactly one of Webhook, Slack or
+// Email must be set.
+type ReceiverConfig struct {
+	Name    string   `yaml:"name"`
+	Webhook *Webhook `yaml:"webhook"`
+	Slack   *Slack   `yaml:"slack"`
+	Email   *Email   `yaml:"email"`
+}
+
+// Route sends alerts whose labels match Match to Receivers, grouped by the
+// GroupBy labels.
+type Route struct {
+	Name           string            `yaml:"name"`
+	Match          map[string]string `yaml:"match"`
+	GroupBy        []string          `yaml:"group_by"`
+	GroupWait      time.Duration     `yaml:"group_wait"`
+	GroupInterval  time.Duration     `yaml:"group_interval"`
+	RepeatInterval time.Duration     `yaml:"repeat_interval"`
+	Receivers      []string          `yaml:"receivers"`
+	// Continue lets later routes match an alert this route matched.
+	Continue bool `yaml:"continue"`
+}
+
+type Config struct {
+	Receivers []ReceiverConfig `yaml:"receivers"`
+	Routes    []Route          `yaml:"routes"`
+	Retry     Retry            `yaml:"retry"`
+}
+
+// LoadConfig reads a YAML notification config.
+func LoadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return Config{}, fmt.Errorf("%s: %v", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return Config{}, fmt.Errorf("%s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// Validate checks the config and fills in defaults.
+func (cfg *Config) Validate() error {
+	names := make(map[string]bool)
+	for i, r := range cfg.Receivers {
+		if r.Name == "" {
+			return fmt.Errorf("receiver %d has no name", i)
+		}
+		if names[r.Name] {
+			return fmt.Errorf("duplicate receiver %s", r.Name)
+		}
+		names[r.Name] = true
+
+		set := 0
+		if r.Webhook != nil {
+			set++
+			if r.Webhook.URL == "" {
+				return fmt.Errorf("receiver %s: webhook url is required", r.Name)
+			}
+		}
+		if r.Slack != nil {
+			set++
+			if r.Slack.URL == "" {
+				return fmt.Errorf("receiver %s: slack url is required", r.Name)
+			}
+		}
+		if r.Email != nil {
+			set++
+			if r.Email.Host == "" || r.Email.From == "" || len(r.Email.To) == 0 {
+				return fmt.Errorf("receiver %s: email host, from and to are required", r.Name)
+			}
+			if r.Email.Port == 0 {
+				r.Email.Port = 25
+			}
+		}
+		if set != 1 {
+			return fmt.Errorf("receiver %s: exactly one of webhook, slack or email must be set", r.Name)
+		}
+	}
+
+	if len(cfg.Routes) == 0 && len(cfg.Receivers) > 0 {
+		route := Route{Name: "default"}
+		for _, r := range cfg.Receivers {
+			route.Receivers = append(route.Receivers, r.Name)
+		}
+		cfg.Routes = []Route{route}
+	}
+
+	for i := range cfg.Routes {
+		route := &cfg.Routes[i]
+		if route.Name == "" {
+			route.Name = fmt.Sprintf("route-%d", i)
+		}
+		if len(route.Receivers) == 0 {
+			return fmt.Errorf("route %s has no receivers", route.Name)
+		}
+		for _, name := range route.Receivers {
+			if !names[name] {
+				return fmt.Errorf("route %s: unknown receiver %s", route.Name, name)
+			}
+		}
+		if len(route.GroupBy) == 0 {
+			route.GroupBy = []string{"alertname"}
+		}
+		if route.GroupWait <= 0 {
+			route.GroupWait = 30 * time.Second
+		}
+		if route.GroupInterval <= 0 {
+			route.GroupInterval = 5 * time.Minute
+		}
+		if route.RepeatInterval <= 0 {
+			route.RepeatInterval = 4 * time.Hour
+		}
+	}
+
+	if cfg.Retry.MaxAttempts <= 0 {
+		cfg.Retry.MaxAttempts = DefaultRetry.MaxAttempts
+	}
+	if cfg.Retry.InitialBackoff <= 0 {
+		cfg.Retry.InitialBackoff = DefaultRetry.InitialBackoff
+	}
+	if cfg.Retry.MaxBackoff <= 0 {
+		cfg.Retry.MaxBackoff = DefaultRetry.MaxBackoff
+	}
+	if cfg.Retry.MaxBackoff < cfg.Retry.InitialBackoff {
+		cfg.Retry.MaxBackoff = cfg.Retry.InitialBackoff
+	}
+	return nil
+}
+
+func (r ReceiverConfig) notifier() (Notifier, error) {
+	switch {
+	case r.Webhook != nil:
+		return r.Webhook, nil
+	case r.Slack != nil:
+		return r.Slack, nil
+	case r.Email != nil:
+		return r.Email, nil
+	}
+	return nil, errors.New("receiver " + r.Name + " has no destination")
+}
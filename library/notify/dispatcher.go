@@ -0,0 +1,253 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"checker/library/alert"
+	"checker/library/metric"
+)
+
+// group collects the alerts of one route sharing the same GroupBy labels.
+type group struct {
+	key      string
+	route    *Route
+	labels   map[string]string
+	alerts   map[string]alert.Alert
+	notified map[string]alert.State // fingerprint -> state last delivered
+	created  time.Time
+	lastSent time.Time
+	sending  bool
+}
+
+// changed reports whether the group holds a state not yet delivered.
+func (g *group) changed() bool {
+	for fingerprint, a := range g.alerts {
+		if g.notified[fingerprint] != a.State {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *group) firing() bool {
+	for _, a := range g.alerts {
+		if a.State == alert.StateFiring {
+			return true
+		}
+	}
+	return false
+}
+
+// Dispatcher routes alert state changes to receivers, grouping alerts per
+// route, deduplicating states already delivered and retrying failures.
+type Dispatcher struct {
+	mu        sync.Mutex
+	routes    []Route
+	receivers map[string]Notifier
+	retry     Retry
+	groups    map[string]*group
+}
+
+func NewDispatcher(cfg Config) (*Dispatcher, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	d := &Dispatcher{
+		routes:    cfg.Routes,
+		receivers: make(map[string]Notifier),
+		retry:     cfg.Retry,
+		groups:    make(map[string]*group),
+	}
+	for _, r := range cfg.Receivers {
+		n, err := r.notifier()
+		if err != nil {
+			return nil, err
+		}
+		d.receivers[r.Name] = n
+	}
+	return d, nil
+}
+
+// Add records an alert state change. Pending and inactive alerts are not
+// notified.
+func (d *Dispatcher) Add(a alert.Alert, now time.Time) {
+	if a.State == alert.StatePending || a.State == alert.StateInactive {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for i := range d.routes {
+		route := &d.routes[i]
+		if !metric.Matches(a.Labels, route.Match) {
+			continue
+		}
+
+		labels := make(map[string]string, len(route.GroupBy))
+		for _, name := range route.GroupBy {
+			labels[name] = a.Labels[name]
+		}
+		key := route.Name + ":" + metric.Key("", labels)
+
+		g, ok := d.groups[key]
+		if !ok {
+			// A resolution for an alert nobody was told about is noise.
+			if a.State == alert.StateResolved {
+				if !route.Continue {
+					break
+				}
+				continue
+			}
+			g = &group{
+				key:      key,
+				route:    route,
+				labels:   labels,
+				alerts:   make(map[string]alert.Alert),
+				notified: make(map[string]alert.State),
+				created:  now,
+			}
+			d.groups[key] = g
+		}
+
+		if a.State == alert.StateResolved && g.notified[a.Fingerprint] == "" {
+			delete(g.alerts, a.Fingerprint)
+		} else {
+			g.alerts[a.Fingerprint] = a
+		}
+
+		if !route.Continue {
+			break
+		}
+	}
+}
+
+// Run consumes alert events and flushes due groups until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context, events <-chan interface{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-events:
+			if a, ok := event.(alert.Alert); ok {
+				d.Add(a, time.Now())
+			}
+		case now := <-ticker.C:
+			d.flush(ctx, now)
+		}
+	}
+}
+
+// flush sends every group that is due: after group_wait for new groups,
+// after group_interval when something changed, and after repeat_interval
+// while alerts keep firing.
+func (d *Dispatcher) flush(ctx context.Context, now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for key, g := range d.groups {
+		if g.sending {
+			continue
+		}
+		if len(g.alerts) == 0 {
+			delete(d.groups, key)
+			continue
+		}
+
+		var due bool
+		switch {
+		case g.lastSent.IsZero():
+			due = now.Sub(g.created) >= g.route.GroupWait
+		case g.changed():
+			due = now.Sub(g.lastSent) >= g.route.GroupInterval
+		default:
+			due = g.firing() && now.Sub(g.lastSent) >= g.route.RepeatInterval
+		}
+		if !due {
+			continue
+		}
+
+		g.sending = true
+		go d.send(ctx, g, d.notification(g, now))
+	}
+}
+
+func (d *Dispatcher) notification(g *group, now time.Time) Notification {
+	n := Notification{
+		Route:       g.route.Name,
+		GroupKey:    groupKey(g),
+		GroupLabels: g.labels,
+		Status:      string(alert.StateResolved),
+		SentAt:      now,
+	}
+	for _, a := range g.alerts {
+		n.Alerts = append(n.Alerts, a)
+		if a.State == alert.StateFiring {
+			n.Status = string(alert.StateFiring)
+		}
+	}
+	sort.Slice(n.Alerts, func(i, j int) bool { return n.Alerts[i].Fingerprint < n.Alerts[j].Fingerprint })
+	return n
+}
+
+func groupKey(g *group) string {
+	parts := make([]string, 0, len(g.labels))
+	for _, name := range g.route.GroupBy {
+		parts = append(parts, fmt.Sprintf("%s=%s", name, g.labels[name]))
+	}
+	return strings.Join(parts, " ")
+}
+
+// send delivers n to every receiver of the route. The group is marked as
+// notified when at least one receiver got it, so a single broken receiver
+// does not cause the others to be spammed on every flush.
+func (d *Dispatcher) send(ctx context.Context, g *group, n Notification) {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	delivered := false
+
+	for _, name := range g.route.Receivers {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			notify := func(ctx context.Context) error { return d.receivers[name].Notify(ctx, n) }
+			if err := deliver(ctx, name, notify, d.retry); err != nil {
+				log.Print(err)
+				return
+			}
+			mu.Lock()
+			delivered = true
+			mu.Unlock()
+		}(name)
+	}
+	wg.Wait()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	g.sending = false
+	if !delivered {
+		return
+	}
+
+	g.lastSent = n.SentAt
+	for _, a := range n.Alerts {
+		g.notified[a.Fingerprint] = a.State
+		// Drop resolved alerts once delivered, unless they fired again
+		// in the meantime.
+		if current := g.alerts[a.Fingerprint]; a.State == alert.StateResolved && current.State == alert.StateResolved {
+			delete(g.alerts, a.Fingerprint)
+			delete(g.notified, a.Fingerprint)
+		}
+	}
+}
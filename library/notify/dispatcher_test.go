@@ -0,0 +1,31 @@
+package notify
+
+import (
+	"testing"
+	"time"
+
+	"checker/library/alert"
+)
+
+func TestDispatcherIgnoresUnfiredAlerts(t *testing.T) {
+	d, err := NewDispatcher(Config{
+		Receivers: []ReceiverConfig{{Name: "hook", Webhook: &Webhook{URL: "http://127.0.0.1:1"}}},
+		Routes:    []Route{{Name: "all", Receivers: []string{"hook"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for _, state := range []alert.State{alert.StatePending, alert.StateInactive, alert.StateResolved} {
+		d.Add(alert.Alert{Fingerprint: "f", State: state}, now)
+	}
+	if len(d.groups) != 0 {
+		t.Errorf("groups = %v, want none for alerts that never fired", d.groups)
+	}
+
+	d.Add(alert.Alert{Fingerprint: "f", State: alert.StateFiring}, now)
+	if len(d.groups) != 1 {
+		t.Errorf("groups = %d, want one for a firing alert", len(d.groups))
+	}
+}
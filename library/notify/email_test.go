@@ -0,0 +1,175 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+// smtpStub is a minimal SMTP server that accepts one session, records the
+// commands and the message, and rejects AUTH when authFails is set.
+type smtpStub struct {
+	ln        net.Listener
+	authFails bool
+	done      chan struct{}
+
+	commands []string
+	data     string
+}
+
+func newSMTPStub(t *testing.T, authFails bool) *smtpStub {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpStub{ln: ln, authFails: authFails, done: make(chan struct{})}
+	go s.serve()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *smtpStub) port() int {
+	return s.ln.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpStub) serve() {
+	defer close(s.done)
+	conn, err := s.ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(lines ...string) {
+		conn.Write([]byte(strings.Join(lines, "\r\n") + "\r\n"))
+	}
+	reply("220 stub ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		s.commands = append(s.commands, line)
+
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch verb {
+		case "EHLO":
+			reply("250-stub", "250 AUTH PLAIN")
+		case "AUTH":
+			if s.authFails {
+				reply("535 5.7.8 authentication failed")
+			} else {
+				reply("235 2.7.0 accepted")
+			}
+		case "MAIL", "RCPT":
+			reply("250 OK")
+		case "DATA":
+			reply("354 go ahead")
+			var b strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				b.WriteString(line)
+			}
+			s.data = b.String()
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func TestEmailNotify(t *testing.T) {
+	stub := newSMTPStub(t, false)
+	e := &Email{
+		Host:     "127.0.0.1",
+		Port:     stub.port(),
+		Username: "alerts",
+		Password: "pw",
+		From:     "uptimex@example.com",
+		To:       []string{"ops@example.com", "oncall@example.com"},
+	}
+	if err := e.Notify(context.Background(), testNotification()); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	<-stub.done
+
+	var verbs []string
+	for _, c := range stub.commands {
+		verbs = append(verbs, strings.SplitN(c, " ", 2)[0])
+	}
+	if got, want := strings.Join(verbs, " "), "EHLO AUTH MAIL RCPT RCPT DATA QUIT"; got != want {
+		t.Errorf("commands = %s, want %s", got, want)
+	}
+	for _, want := range []string{"MAIL FROM:<uptimex@example.com>", "RCPT TO:<ops@example.com>", "RCPT TO:<oncall@example.com>"} {
+		found := false
+		for _, c := range stub.commands {
+			found = found || strings.HasPrefix(c, want)
+		}
+		if !found {
+			t.Errorf("no command %q in %q", want, stub.commands)
+		}
+	}
+
+	for _, want := range []string{
+		"From: uptimex@example.com\r\n",
+		"To: ops@example.com, oncall@example.com\r\n",
+		"Subject: [FIRING:1] host=web1\r\n",
+		"Date: Wed, 01 May 2024 12:01:00 +0000\r\n",
+		"Content-Type: text/plain; charset=utf-8\r\n\r\n",
+		"[FIRING] cpu.usage{host=web1} is 97 (threshold 90)\r\n",
+		"  host: web1\r\n  severity: page\r\n",
+		"  active since: 2024-05-01T12:00:00Z\r\n",
+	} {
+		if !strings.Contains(stub.data, want) {
+			t.Errorf("message lacks %q:\n%s", want, stub.data)
+		}
+	}
+}
+
+func TestEmailAuthFailureIsPermanent(t *testing.T) {
+	stub := newSMTPStub(t, true)
+	e := &Email{
+		Host:     "127.0.0.1",
+		Port:     stub.port(),
+		Username: "alerts",
+		Password: "wrong",
+		From:     "uptimex@example.com",
+		To:       []string{"ops@example.com"},
+	}
+	err := e.Notify(context.Background(), testNotification())
+	var permanent permanentError
+	if !errors.As(err, &permanent) {
+		t.Errorf("Notify = %v, want a permanent error", err)
+	}
+}
+
+func TestEmailConnectionRefused(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	e := &Email{Host: "127.0.0.1", Port: port, From: "a@example.com", To: []string{"b@example.com"}}
+	err = e.Notify(context.Background(), testNotification())
+	var permanent permanentError
+	if err == nil || errors.As(err, &permanent) {
+		t.Errorf("Notify to port %d = %v, want an error worth retrying", port, err)
+	}
+}
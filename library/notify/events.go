@@ -0,0 +1,63 @@
+package notify
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// maxBatch bounds how many events are sent in one request.
+const maxBatch = 100
+
+// EventBatch is the body of an event webhook request.
+type EventBatch struct {
+	Source string        `json:"source"`
+	Events []interface{} `json:"events"`
+	SentAt time.Time     `json:"sent_at"`
+}
+
+// Forward posts events to every webhook until ctx is done or events is
+// closed. Events that arrive together, e.g. from one collection, are sent
+// as one batch. Deliveries are retried like notifications.
+func Forward(ctx context.Context, source string, events <-chan interface{}, hooks []*Webhook, retry Retry) {
+	for {
+		var batch []interface{}
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			batch = append(batch, event)
+		}
+
+	drain:
+		for len(batch) < maxBatch {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, event)
+			default:
+				break drain
+			}
+		}
+
+		payload := EventBatch{Source: source, Events: batch, SentAt: time.Now()}
+		var wg sync.WaitGroup
+		for _, hook := range hooks {
+			wg.Add(1)
+			go func(hook *Webhook) {
+				defer wg.Done()
+				post := func(ctx context.Context) error { return hook.Post(ctx, payload) }
+				if err := deliver(ctx, hook.URL, post, retry); err != nil {
+					log.Print(err)
+				}
+			}(hook)
+		}
+		wg.Wait()
+	}
+}
@@ -0,0 +1,99 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"checker/library/alert"
+)
+
+// Notification is one delivery of a group of alerts to a receiver.
+type Notification struct {
+	Route       string            `json:"route"`
+	GroupKey    string            `json:"group_key"`
+	GroupLabels map[string]string `json:"group_labels"`
+	Status      string            `json:"status"`
+	Alerts      []alert.Alert     `json:"alerts"`
+	SentAt      time.Time         `json:"sent_at"`
+}
+
+// Notifier delivers notifications to one destination.
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// permanentError marks a delivery failure that retrying cannot fix, such
+// as a 4xx response from a webhook.
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Retry configures how failed deliveries are retried with exponential
+// backoff.
+type Retry struct {
+	MaxAttempts    int           `yaml:"max_attempts"`
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	MaxBackoff     time.Duration `yaml:"max_backoff"`
+}
+
+var DefaultRetry = Retry{
+	MaxAttempts:    5,
+	InitialBackoff: time.Second,
+	MaxBackoff:     30 * time.Second,
+}
+
+// deliver calls send until it succeeds, fails permanently, runs out of
+// attempts or ctx is done.
+func deliver(ctx context.Context, name string, send func(ctx context.Context) error, retry Retry) error {
+	backoff := retry.InitialBackoff
+	var err error
+	for attempt := 1; attempt <= retry.MaxAttempts; attempt++ {
+		if err = send(ctx); err == nil {
+			return nil
+		}
+
+		var permanent permanentError
+		if errors.As(err, &permanent) || attempt == retry.MaxAttempts {
+			break
+		}
+		log.Printf("Notification to %s failed (attempt %d/%d), retrying in %s: %v", name, attempt, retry.MaxAttempts, backoff, err)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if backoff *= 2; backoff > retry.MaxBackoff {
+			backoff = retry.MaxBackoff
+		}
+	}
+	return fmt.Errorf("notification to %s failed: %w", name, err)
+}
+
+// summary returns a one-line description of a notification.
+func summary(n Notification) string {
+	firing := 0
+	for _, a := range n.Alerts {
+		if a.State == alert.StateFiring {
+			firing++
+		}
+	}
+	if n.Status == "resolved" {
+		return fmt.Sprintf("[RESOLVED] %s", n.GroupKey)
+	}
+	return fmt.Sprintf("[FIRING:%d] %s", firing, n.GroupKey)
+}
+
+// describe returns a one-line description of an alert.
+func describe(a alert.Alert) string {
+	if s := a.Annotations["summary"]; s != "" {
+		return s
+	}
+	return fmt.Sprintf("%s is %g (threshold %g)", a.Fingerprint, a.Value, a.Threshold)
+}
@@ -0,0 +1,94 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"checker/library/alert"
+)
+
+// Slack posts notifications to a Slack or Mattermost incoming webhook.
+type Slack struct {
+	URL      string        `yaml:"url"`
+	Channel  string        `yaml:"channel"`
+	Username string        `yaml:"username"`
+	Timeout  time.Duration `yaml:"timeout"`
+
+	Client *http.Client `yaml:"-"`
+}
+
+// SlackField, SlackAttachment and SlackMessage follow the incoming-webhook
+// format understood by both Slack and Mattermost.
+type SlackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+type SlackAttachment struct {
+	Color    string       `json:"color"`
+	Title    string       `json:"title"`
+	Text     string       `json:"text"`
+	Fields   []SlackField `json:"fields,omitempty"`
+	Fallback string       `json:"fallback"`
+}
+
+type SlackMessage struct {
+	Channel     string            `json:"channel,omitempty"`
+	Username    string            `json:"username,omitempty"`
+	Text        string            `json:"text"`
+	Attachments []SlackAttachment `json:"attachments"`
+}
+
+// SlackPayload builds the incoming-webhook message for n.
+func SlackPayload(n Notification, channel, username string) SlackMessage {
+	color := "danger"
+	if n.Status == "resolved" {
+		color = "good"
+	}
+
+	lines := make([]string, 0, len(n.Alerts))
+	for _, a := range n.Alerts {
+		prefix := "🔥"
+		if a.State == alert.StateResolved {
+			prefix = "✅"
+		}
+		lines = append(lines, prefix+" "+describe(a))
+	}
+
+	names := make([]string, 0, len(n.GroupLabels))
+	for k := range n.GroupLabels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	fields := make([]SlackField, 0, len(names))
+	for _, k := range names {
+		fields = append(fields, SlackField{Title: k, Value: n.GroupLabels[k], Short: true})
+	}
+
+	title := summary(n)
+	return SlackMessage{
+		Channel:  channel,
+		Username: username,
+		Text:     title,
+		Attachments: []SlackAttachment{{
+			Color:    color,
+			Title:    title,
+			Text:     strings.Join(lines, "\n"),
+			Fields:   fields,
+			Fallback: title,
+		}},
+	}
+}
+
+func (s *Slack) Notify(ctx context.Context, n Notification) error {
+	body, err := json.Marshal(SlackPayload(n, s.Channel, s.Username))
+	if err != nil {
+		return permanentError{err}
+	}
+	return postJSON(ctx, s.Client, s.URL, s.Timeout, body, nil)
+}
@@ -0,0 +1,100 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	SignatureHeader = "X-UptimeX-Signature"
+	TimestampHeader = "X-UptimeX-Timestamp"
+)
+
+// Webhook posts notifications as JSON. When a secret is set, requests carry
+// an HMAC-SHA256 of "<timestamp>.<body>" in the X-UptimeX-Signature header
+// so receivers can verify origin and reject replays.
+type Webhook struct {
+	URL     string            `yaml:"url"`
+	Secret  string            `yaml:"secret"`
+	Headers map[string]string `yaml:"headers"`
+	Timeout time.Duration     `yaml:"timeout"`
+
+	Client *http.Client `yaml:"-"`
+}
+
+// Sign returns the signature of body sent at timestamp.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (w *Webhook) Notify(ctx context.Context, n Notification) error {
+	return w.Post(ctx, n)
+}
+
+// Post sends v as a signed JSON request.
+func (w *Webhook) Post(ctx context.Context, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return permanentError{err}
+	}
+	return postJSON(ctx, w.Client, w.URL, w.Timeout, body, func(req *http.Request) {
+		for k, v := range w.Headers {
+			req.Header.Set(k, v)
+		}
+		if w.Secret != "" {
+			timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+			req.Header.Set(TimestampHeader, timestamp)
+			req.Header.Set(SignatureHeader, Sign(w.Secret, timestamp, body))
+		}
+	})
+}
+
+// postJSON posts body and classifies the response: 4xx other than 429 is
+// permanent, anything else unsuccessful is worth retrying.
+func postJSON(ctx context.Context, client *http.Client, url string, timeout time.Duration, body []byte, prepare func(req *http.Request)) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return permanentError{err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if prepare != nil {
+		prepare(req)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("%s returned %s", url, resp.Status)
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+		return permanentError{err}
+	}
+	return err
+}
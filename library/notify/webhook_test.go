@@ -0,0 +1,189 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"checker/library/alert"
+)
+
+func testNotification() Notification {
+	active := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	return Notification{
+		Route:       "ops",
+		GroupKey:    "host=web1",
+		GroupLabels: map[string]string{"host": "web1"},
+		Status:      string(alert.StateFiring),
+		Alerts: []alert.Alert{{
+			Fingerprint: "cpu.usage{host=web1}",
+			Rule:        "high-cpu",
+			Metric:      "cpu.usage",
+			Labels:      map[string]string{"host": "web1", "severity": "page"},
+			State:       alert.StateFiring,
+			Value:       97,
+			Threshold:   90,
+			ActiveAt:    active,
+		}},
+		SentAt: active.Add(time.Minute),
+	}
+}
+
+func TestWebhookSignature(t *testing.T) {
+	const secret = "s3cret"
+	var (
+		gotBody   []byte
+		gotHeader http.Header
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotBody, _ = io.ReadAll(r.Body)
+		gotHeader = r.Header.Clone()
+	}))
+	defer srv.Close()
+
+	w := &Webhook{URL: srv.URL, Secret: secret, Headers: map[string]string{"X-Team": "ops"}}
+	if err := w.Notify(context.Background(), testNotification()); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	if ct := gotHeader.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if team := gotHeader.Get("X-Team"); team != "ops" {
+		t.Errorf("X-Team = %q, want ops", team)
+	}
+	timestamp := gotHeader.Get(TimestampHeader)
+	if timestamp == "" {
+		t.Fatalf("no %s header", TimestampHeader)
+	}
+	if got, want := gotHeader.Get(SignatureHeader), Sign(secret, timestamp, gotBody); got != want {
+		t.Errorf("signature = %q, want %q", got, want)
+	}
+	if Sign("other", timestamp, gotBody) == Sign(secret, timestamp, gotBody) {
+		t.Error("signature does not depend on the secret")
+	}
+
+	var n Notification
+	if err := json.Unmarshal(gotBody, &n); err != nil {
+		t.Fatalf("body: %v", err)
+	}
+	if n.GroupKey != "host=web1" || len(n.Alerts) != 1 || n.Alerts[0].Rule != "high-cpu" {
+		t.Errorf("body = %+v", n)
+	}
+}
+
+func TestWebhookUnsigned(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(SignatureHeader) != "" || r.Header.Get(TimestampHeader) != "" {
+			t.Errorf("request without a secret is signed: %v", r.Header)
+		}
+	}))
+	defer srv.Close()
+
+	w := &Webhook{URL: srv.URL}
+	if err := w.Notify(context.Background(), testNotification()); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+}
+
+// statusServer answers with the given statuses in turn, repeating the last,
+// and records when each request arrived.
+type statusServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	times    []time.Time
+}
+
+func newStatusServer(statuses ...int) *statusServer {
+	s := &statusServer{statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		status := s.statuses[min(len(s.times), len(s.statuses)-1)]
+		s.times = append(s.times, time.Now())
+		w.WriteHeader(status)
+	}))
+	return s
+}
+
+func (s *statusServer) attempts() []time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]time.Time(nil), s.times...)
+}
+
+func TestWebhookRetry(t *testing.T) {
+	retry := Retry{MaxAttempts: 4, InitialBackoff: 20 * time.Millisecond, MaxBackoff: 40 * time.Millisecond}
+
+	for _, tt := range []struct {
+		name         string
+		statuses     []int
+		wantAttempts int
+		wantErr      bool
+		permanent    bool
+	}{
+		{"success", []int{http.StatusOK}, 1, false, false},
+		{"5xx then success", []int{http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusNoContent}, 3, false, false},
+		{"5xx until attempts run out", []int{http.StatusInternalServerError}, 4, true, false},
+		{"429 is retried", []int{http.StatusTooManyRequests, http.StatusOK}, 2, false, false},
+		{"4xx is not retried", []int{http.StatusBadRequest}, 1, true, true},
+		{"401 is not retried", []int{http.StatusUnauthorized, http.StatusOK}, 1, true, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newStatusServer(tt.statuses...)
+			defer srv.Close()
+
+			w := &Webhook{URL: srv.URL}
+			send := func(ctx context.Context) error { return w.Notify(ctx, testNotification()) }
+			err := deliver(context.Background(), "hook", send, retry)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("deliver = %v, want error %v", err, tt.wantErr)
+			}
+			var permanent permanentError
+			if got := errors.As(err, &permanent); got != tt.permanent {
+				t.Errorf("permanent = %v, want %v (err %v)", got, tt.permanent, err)
+			}
+
+			times := srv.attempts()
+			if len(times) != tt.wantAttempts {
+				t.Fatalf("attempts = %d, want %d", len(times), tt.wantAttempts)
+			}
+			// The backoff doubles from InitialBackoff up to MaxBackoff.
+			backoff := retry.InitialBackoff
+			for i := 1; i < len(times); i++ {
+				if gap := times[i].Sub(times[i-1]); gap < backoff {
+					t.Errorf("attempt %d came %s after the last, want at least %s", i+1, gap, backoff)
+				}
+				backoff = min(2*backoff, retry.MaxBackoff)
+			}
+		})
+	}
+}
+
+func TestDeliverStopsOnCancel(t *testing.T) {
+	srv := newStatusServer(http.StatusServiceUnavailable)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &Webhook{URL: srv.URL}
+	send := func(ctx context.Context) error {
+		err := w.Notify(ctx, testNotification())
+		cancel()
+		return err
+	}
+	err := deliver(ctx, "hook", send, Retry{MaxAttempts: 5, InitialBackoff: time.Hour, MaxBackoff: time.Hour})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("deliver = %v, want context.Canceled", err)
+	}
+	if n := len(srv.attempts()); n != 1 {
+		t.Errorf("attempts = %d, want 1", n)
+	}
+}
@@ -0,0 +1,403 @@
+package oom
+
+import (
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	cgroupinfo "checker/library/cgroup"
+	memoryinfo "checker/library/memory"
+	processinfo "checker/library/process"
+	"checker/library/stream"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	ScopeSystem = "system"
+	ScopeCgroup = "cgroup"
+)
+
+// RecentWindow is how long a kill counts towards Snapshot, and so how long
+// an alert on it keeps firing.
+const RecentWindow = 5 * time.Minute
+
+// maxRecentEvents bounds the events kept for Recent.
+const maxRecentEvents = 1000
+
+// Attributions of an event's victims. They are matched when exactly as
+// many processes in scope exited as were killed, candidates when more did,
+// so some of them may have exited normally, and unknown when no process
+// sweep from before the kill was kept to compare with.
+const (
+	AttributionMatched   = "matched"
+	AttributionCandidate = "candidate"
+	AttributionUnknown   = "unknown"
+)
+
+// Victim is a process of the sweep before a kill that was gone in the
+// sweep after it, so likely the one killed.
+type Victim struct {
+	Pid         int32  `json:"pid"`
+	Name        string `json:"name,omitempty"`
+	Cmdline     string `json:"cmdline,omitempty"`
+	Username    string `json:"username,omitempty"`
+	RSS         uint64 `json:"rss"`
+	Cgroup      string `json:"cgroup,omitempty"`
+	ContainerID string `json:"container_id,omitempty"`
+}
+
+// Event is one or more OOM kills detected between two samples. System
+// events count every kill, from the oom_kill counter in /proc/vmstat;
+// cgroup events name the cgroup whose memory limit was hit, so a kill
+// inside a cgroup is reported once in each scope.
+type Event struct {
+	Time time.Time `json:"time"`
+	// Since is the time of the previous sample, which showed no new kill.
+	Since       time.Time `json:"since"`
+	Scope       string    `json:"scope"`
+	Cgroup      string    `json:"cgroup,omitempty"`
+	ContainerID string    `json:"container_id,omitempty"`
+	Kills       uint64    `json:"kills"`
+	// Victims are ordered by RSS, largest first, as the kernel prefers
+	// killing the largest process. There are at most Kills of them. They
+	// are filled in by the first process sweep after the kill, when the
+	// event is published, and Attribution is set.
+	Attribution string   `json:"attribution,omitempty"`
+	Victims     []Victim `json:"victims,omitempty"`
+}
+
+// CgroupKills is the number of kills in one cgroup within RecentWindow.
+type CgroupKills struct {
+	Cgroup      string `json:"cgroup"`
+	ContainerID string `json:"container_id,omitempty"`
+	Kills       uint64 `json:"kills"`
+}
+
+// Snapshot counts the kills detected within RecentWindow before Time.
+type Snapshot struct {
+	Time        time.Time     `json:"time"`
+	SystemKills uint64        `json:"system_kills"`
+	Cgroups     []CgroupKills `json:"cgroups"`
+	Events      []Event       `json:"events"`
+}
+
+// maxSweeps bounds the process sweeps kept to attribute kills.
+const maxSweeps = 4
+
+// sweep is a process sweep and the time it was taken.
+type sweep struct {
+	time  time.Time
+	procs []processinfo.Process
+}
+
+// Detector detects OOM kills from successive memory and cgroup samples
+// and attributes them to processes that exited between the last process
+// sweep before the kill and the first one after it.
+type Detector struct {
+	hub *stream.Hub
+
+	mu          sync.Mutex
+	systemKills *uint64
+	systemTime  time.Time
+	cgroupKills map[string]uint64
+	cgroupTime  time.Time
+	// sweeps are the recent process sweeps, oldest first.
+	sweeps []sweep
+	recent []*Event
+	// pending are the events detected since the last sweep, awaiting the
+	// next one to find their victims.
+	pending []*Event
+}
+
+func NewDetector() *Detector {
+	return &Detector{hub: stream.NewHub()}
+}
+
+// Hub publishes every event once its victims are known.
+func (d *Detector) Hub() *stream.Hub {
+	return d.hub
+}
+
+// ObserveProcesses remembers a process sweep taken at t. Pending events
+// detected before t are attributed to the processes missing from it, and
+// published.
+func (d *Detector) ObserveProcesses(t time.Time, snap processinfo.Snapshot) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var waiting []*Event
+	for _, e := range d.pending {
+		if !e.Time.Before(t) {
+			waiting = append(waiting, e)
+			continue
+		}
+		before, ok := d.sweepBefore(e.Since)
+		if !ok {
+			e.Attribution = AttributionUnknown
+		} else {
+			e.Attribution, e.Victims = victims(exited(before.procs, snap.Processes), e.Kills, e.Cgroup)
+		}
+		d.hub.Publish(*e)
+	}
+	d.pending = waiting
+
+	d.sweeps = append(d.sweeps, sweep{time: t, procs: snap.Processes})
+	d.prune()
+}
+
+// sweepBefore returns the last sweep taken no later than t.
+func (d *Detector) sweepBefore(t time.Time) (sweep, bool) {
+	for i := len(d.sweeps) - 1; i >= 0; i-- {
+		if !d.sweeps[i].time.After(t) {
+			return d.sweeps[i], true
+		}
+	}
+	return sweep{}, false
+}
+
+// prune drops the sweeps no pending or future event can be attributed
+// from: those before the last sweep preceding the oldest sample a kill
+// can still be detected since. The caller holds d.mu.
+func (d *Detector) prune() {
+	oldest := d.systemTime
+	if oldest.IsZero() || (!d.cgroupTime.IsZero() && d.cgroupTime.Before(oldest)) {
+		oldest = d.cgroupTime
+	}
+	for _, e := range d.pending {
+		if e.Since.Before(oldest) {
+			oldest = e.Since
+		}
+	}
+
+	keep := 0
+	for i, sw := range d.sweeps {
+		if !sw.time.After(oldest) {
+			keep = i
+		}
+	}
+	if over := len(d.sweeps) - maxSweeps; over > keep {
+		keep = over
+	}
+	d.sweeps = append([]sweep(nil), d.sweeps[keep:]...)
+}
+
+// exited returns the processes of before missing from after, or replaced
+// by a process reusing their pid, ordered by RSS, largest first.
+func exited(before, after []processinfo.Process) []processinfo.Process {
+	current := make(map[int32]int64, len(after))
+	for _, p := range after {
+		current[p.Pid] = p.CreateTime
+	}
+	var gone []processinfo.Process
+	for _, p := range before {
+		createTime, ok := current[p.Pid]
+		// A pid reused by a new process, when both create times are known.
+		reused := ok && p.CreateTime != 0 && createTime != 0 && createTime != p.CreateTime
+		if !ok || reused {
+			gone = append(gone, p)
+		}
+	}
+	sort.Slice(gone, func(i, j int) bool { return rss(gone[i]) > rss(gone[j]) })
+	return gone
+}
+
+// ObserveMemory compares the oom_kill counter of a memory sample taken at
+// t with the previous one. The first sample only sets the baseline.
+func (d *Detector) ObserveMemory(t time.Time, snap memoryinfo.Snapshot) []Event {
+	if snap.Paging == nil {
+		return nil
+	}
+	kills := snap.Paging.OOMKills
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	prev, since := d.systemKills, d.systemTime
+	d.systemKills, d.systemTime = &kills, t
+	if prev == nil || kills <= *prev {
+		return nil
+	}
+
+	e := Event{Time: t, Since: since, Scope: ScopeSystem, Kills: kills - *prev}
+	d.add(&e)
+	return []Event{e}
+}
+
+// ObserveCgroups compares the oom_kill events of every cgroup in a cgroup
+// sample taken at t with the previous one. On the unified hierarchy the
+// counts include descendants, so kills are reported for the deepest
+// cgroups they happened in.
+func (d *Detector) ObserveCgroups(t time.Time, snap cgroupinfo.Snapshot) []Event {
+	current := make(map[string]uint64)
+	containers := make(map[string]string)
+	for _, cg := range snap.Cgroups {
+		if cg.Memory == nil {
+			continue
+		}
+		if kills, ok := cg.Memory.Events["oom_kill"]; ok {
+			current[cg.Path] = kills
+			containers[cg.Path] = cg.ContainerID
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	prev, since := d.cgroupKills, d.cgroupTime
+	d.cgroupKills, d.cgroupTime = current, t
+	if prev == nil {
+		return nil
+	}
+
+	deltas := make(map[string]uint64)
+	for p, kills := range current {
+		// Cgroups created since the last sample start from zero.
+		if kills > prev[p] {
+			deltas[p] = kills - prev[p]
+		}
+	}
+	if snap.Version == 2 {
+		local := make(map[string]uint64, len(deltas))
+		for p, delta := range deltas {
+			local[p] = delta
+		}
+		for p, delta := range deltas {
+			if parent := path.Dir(p); parent != p {
+				if _, ok := local[parent]; ok {
+					local[parent] -= min(delta, local[parent])
+				}
+			}
+		}
+		deltas = local
+	}
+
+	paths := make([]string, 0, len(deltas))
+	for p, delta := range deltas {
+		if delta > 0 {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+
+	events := make([]Event, 0, len(paths))
+	for _, p := range paths {
+		e := Event{Time: t, Since: since, Scope: ScopeCgroup, Cgroup: p, ContainerID: containers[p], Kills: deltas[p]}
+		d.add(&e)
+		events = append(events, e)
+	}
+	return events
+}
+
+// victims returns up to n of the exited processes, which are ordered by
+// RSS, limited to those in cgroup or below it if it is not empty, and how
+// sure the attribution is. Processes without memory, such as kernel
+// threads, are never killed.
+func victims(gone []processinfo.Process, n uint64, cgroup string) (string, []Victim) {
+	var inScope []processinfo.Process
+	for _, p := range gone {
+		if cgroup != "" && cgroup != "/" && p.Cgroup != cgroup && !strings.HasPrefix(p.Cgroup, cgroup+"/") {
+			continue
+		}
+		if rss(p) == 0 {
+			continue
+		}
+		inScope = append(inScope, p)
+	}
+
+	attribution := AttributionMatched
+	if uint64(len(inScope)) > n {
+		attribution = AttributionCandidate
+		inScope = inScope[:n]
+	}
+
+	victims := make([]Victim, 0, len(inScope))
+	for _, p := range inScope {
+		victims = append(victims, Victim{
+			Pid:         p.Pid,
+			Name:        p.Name,
+			Cmdline:     p.Cmdline,
+			Username:    p.Username,
+			RSS:         rss(p),
+			Cgroup:      p.Cgroup,
+			ContainerID: p.ContainerID,
+		})
+	}
+	return attribution, victims
+}
+
+func rss(p processinfo.Process) uint64 {
+	if p.MemoryInfo == nil {
+		return 0
+	}
+	return p.MemoryInfo.RSS
+}
+
+// add records e, and publishes it right away if no process sweep will
+// attribute it. The caller holds d.mu.
+func (d *Detector) add(e *Event) {
+	d.recent = append(d.recent, e)
+	if over := len(d.recent) - maxRecentEvents; over > 0 {
+		d.recent = append([]*Event(nil), d.recent[over:]...)
+	}
+	if len(d.sweeps) == 0 {
+		e.Attribution = AttributionUnknown
+		d.hub.Publish(*e)
+		return
+	}
+	d.pending = append(d.pending, e)
+}
+
+// Recent returns the most recent events, oldest first.
+func (d *Detector) Recent() []Event {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	events := make([]Event, 0, len(d.recent))
+	for _, e := range d.recent {
+		events = append(events, *e)
+	}
+	return events
+}
+
+// Snapshot counts the kills detected within RecentWindow before t.
+func (d *Detector) Snapshot(t time.Time) Snapshot {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	snap := Snapshot{Time: t, Cgroups: []CgroupKills{}, Events: []Event{}}
+	cgroups := make(map[string]*CgroupKills)
+	for _, e := range d.recent {
+		if t.Sub(e.Time) > RecentWindow {
+			continue
+		}
+		snap.Events = append(snap.Events, *e)
+		if e.Scope == ScopeSystem {
+			snap.SystemKills += e.Kills
+			continue
+		}
+		c, ok := cgroups[e.Cgroup]
+		if !ok {
+			c = &CgroupKills{Cgroup: e.Cgroup, ContainerID: e.ContainerID}
+			cgroups[e.Cgroup] = c
+		}
+		c.Kills += e.Kills
+	}
+	for _, c := range cgroups {
+		snap.Cgroups = append(snap.Cgroups, *c)
+	}
+	sort.Slice(snap.Cgroups, func(i, j int) bool { return snap.Cgroups[i].Cgroup < snap.Cgroups[j].Cgroup })
+	return snap
+}
+
+// Handler serves the kills within RecentWindow. ?all=true serves every
+// event kept instead.
+func (d *Detector) Handler(c *gin.Context) {
+	if c.Query("all") == "true" {
+		c.JSON(http.StatusOK, d.Recent())
+		return
+	}
+	c.JSON(http.StatusOK, d.Snapshot(time.Now()))
+}
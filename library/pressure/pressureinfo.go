@@ -0,0 +1,161 @@
+package pressureinfo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrUnavailable is returned when no pressure files exist at the root,
+// e.g. on kernels older than 4.20 or built without CONFIG_PSI.
+var ErrUnavailable = errors.New("pressure stall information not available")
+
+// Averages is the share of time in percent that tasks were stalled over
+// the last 10, 60 and 300 seconds, and the total stall time in
+// microseconds.
+type Averages struct {
+	Avg10  float64 `json:"avg10"`
+	Avg60  float64 `json:"avg60"`
+	Avg300 float64 `json:"avg300"`
+	Total  uint64  `json:"total"`
+}
+
+// Resource is the pressure on one resource. Some covers time in which at
+// least one task was stalled, Full time in which all non-idle tasks were.
+type Resource struct {
+	Some *Averages `json:"some,omitempty"`
+	Full *Averages `json:"full,omitempty"`
+}
+
+// Snapshot is the pressure on CPU, memory and IO. Resources whose file
+// could not be read are nil.
+type Snapshot struct {
+	CPU    *Resource `json:"cpu,omitempty"`
+	Memory *Resource `json:"memory,omitempty"`
+	IO     *Resource `json:"io,omitempty"`
+}
+
+// ResourceNames are the names of the resources, in the order they are
+// reported.
+var ResourceNames = []string{"cpu", "memory", "io"}
+
+// Resource returns the pressure on the named resource, or nil.
+func (s Snapshot) Resource(name string) *Resource {
+	switch name {
+	case "cpu":
+		return s.CPU
+	case "memory":
+		return s.Memory
+	case "io":
+		return s.IO
+	}
+	return nil
+}
+
+// Options controls where the pressure files are read from.
+type Options struct {
+	Root string
+}
+
+var DefaultOptions = Options{Root: "/proc/pressure"}
+
+// Collect reads the system-wide pressure from the default root.
+func Collect(ctx context.Context) (Snapshot, error) {
+	return CollectWithOptions(ctx, DefaultOptions)
+}
+
+// CollectWithOptions reads the cpu, memory and io files under opts.Root.
+func CollectWithOptions(ctx context.Context, opts Options) (Snapshot, error) {
+	snap, ok := read(func(resource string) string { return filepath.Join(opts.Root, resource) })
+	if !ok {
+		return Snapshot{}, fmt.Errorf("%w at %s", ErrUnavailable, opts.Root)
+	}
+	return snap, nil
+}
+
+// ReadCgroup reads the cpu.pressure, memory.pressure and io.pressure files
+// of a cgroup v2 directory. It returns false if there are none.
+func ReadCgroup(dir string) (Snapshot, bool) {
+	return read(func(resource string) string { return filepath.Join(dir, resource+".pressure") })
+}
+
+func read(path func(resource string) string) (Snapshot, bool) {
+	var snap Snapshot
+	found := false
+	for resource, field := range map[string]**Resource{"cpu": &snap.CPU, "memory": &snap.Memory, "io": &snap.IO} {
+		data, err := os.ReadFile(path(resource))
+		if err != nil {
+			continue
+		}
+		r, err := Parse(string(data))
+		if err != nil {
+			continue
+		}
+		*field = &r
+		found = true
+	}
+	return snap, found
+}
+
+// Parse parses the contents of a pressure file:
+//
+//	some avg10=0.12 avg60=0.05 avg300=0.01 total=123456
+//	full avg10=0.00 avg60=0.00 avg300=0.00 total=0
+func Parse(data string) (Resource, error) {
+	var r Resource
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		var a Averages
+		for _, field := range fields[1:] {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok {
+				return Resource{}, fmt.Errorf("invalid field %q", field)
+			}
+			var err error
+			switch key {
+			case "avg10":
+				a.Avg10, err = strconv.ParseFloat(value, 64)
+			case "avg60":
+				a.Avg60, err = strconv.ParseFloat(value, 64)
+			case "avg300":
+				a.Avg300, err = strconv.ParseFloat(value, 64)
+			case "total":
+				a.Total, err = strconv.ParseUint(value, 10, 64)
+			}
+			if err != nil {
+				return Resource{}, fmt.Errorf("invalid %s: %v", key, err)
+			}
+		}
+
+		switch fields[0] {
+		case "some":
+			r.Some = &a
+		case "full":
+			r.Full = &a
+		}
+	}
+	if r.Some == nil && r.Full == nil {
+		return Resource{}, errors.New("no some or full line")
+	}
+	return r, nil
+}
+
+func GetPressureInfo(c *gin.Context) {
+	snap, err := Collect(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, snap)
+}
@@ -0,0 +1,71 @@
+package pressureinfo
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	for _, tt := range []struct {
+		name, data string
+		want       Resource
+		wantErr    bool
+	}{
+		{
+			name: "some only",
+			data: "some avg10=1.25 avg60=0.50 avg300=0.10 total=123456\n",
+			want: Resource{Some: &Averages{Avg10: 1.25, Avg60: 0.5, Avg300: 0.1, Total: 123456}},
+		},
+		{
+			name: "some and full",
+			data: "some avg10=2.00 avg60=1.00 avg300=0.25 total=654321\nfull avg10=0.75 avg60=0.30 avg300=0.05 total=98765\n",
+			want: Resource{
+				Some: &Averages{Avg10: 2, Avg60: 1, Avg300: 0.25, Total: 654321},
+				Full: &Averages{Avg10: 0.75, Avg60: 0.3, Avg300: 0.05, Total: 98765},
+			},
+		},
+		{name: "empty", data: "", wantErr: true},
+		{name: "field without value", data: "some avg10\n", wantErr: true},
+		{name: "invalid total", data: "some avg10=0.00 total=-1\n", wantErr: true},
+	} {
+		got, err := Parse(tt.data)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Parse = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// The cpu fixture has no full line, as on kernels before 5.13.
+func TestCollectWithOptions(t *testing.T) {
+	snap, err := CollectWithOptions(context.Background(), Options{Root: "testdata"})
+	if err != nil {
+		t.Fatalf("CollectWithOptions: %v", err)
+	}
+	want := Snapshot{
+		CPU: &Resource{Some: &Averages{Avg10: 1.25, Avg60: 0.5, Avg300: 0.1, Total: 123456}},
+		Memory: &Resource{
+			Some: &Averages{Avg10: 2, Avg60: 1, Avg300: 0.25, Total: 654321},
+			Full: &Averages{Avg10: 0.75, Avg60: 0.3, Avg300: 0.05, Total: 98765},
+		},
+		IO: &Resource{
+			Some: &Averages{Total: 42},
+			Full: &Averages{Total: 7},
+		},
+	}
+	if !reflect.DeepEqual(snap, want) {
+		t.Errorf("CollectWithOptions = %+v, want %+v", snap, want)
+	}
+}
+
+func TestCollectUnavailable(t *testing.T) {
+	_, err := CollectWithOptions(context.Background(), Options{Root: t.TempDir()})
+	if !errors.Is(err, ErrUnavailable) {
+		t.Errorf("err = %v, want ErrUnavailable", err)
+	}
+}
@@ -0,0 +1,180 @@
+package processinfo
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/process"
+)
+
+// IORates are a process's IO rates per second.
+type IORates struct {
+	ReadCount  float64 `json:"read_count_per_second"`
+	WriteCount float64 `json:"write_count_per_second"`
+	ReadBytes  float64 `json:"read_bytes_per_second"`
+	WriteBytes float64 `json:"write_bytes_per_second"`
+}
+
+// PageFaultRates are a process's page faults per second.
+type PageFaultRates struct {
+	Minor float64 `json:"minor_per_second"`
+	Major float64 `json:"major_per_second"`
+}
+
+// counters are the cumulative values rates are computed from.
+type counters struct {
+	at     time.Time
+	cpu    float64 // user+system seconds
+	hasCPU bool
+	io     *process.IOCountersStat
+	faults *process.PageFaultsStat
+}
+
+func readCounters(ctx context.Context, proc *process.Process) counters {
+	c := counters{at: time.Now()}
+	if times, err := proc.TimesWithContext(ctx); err == nil {
+		c.cpu, c.hasCPU = times.User+times.System, true
+	}
+	if io, err := proc.IOCountersWithContext(ctx); err == nil {
+		c.io = io
+	}
+	if faults, err := proc.PageFaultsWithContext(ctx); err == nil {
+		c.faults = faults
+	}
+	return c
+}
+
+// processKey identifies a process across collections. The create time
+// keeps a reused pid from inheriting the counters of an exited process.
+type processKey struct {
+	pid        int32
+	createTime int64
+}
+
+// Collector collects processes and keeps each process's counters between
+// collections, so CPU percent and rates cover the last interval rather
+// than the process's lifetime.
+type Collector struct {
+	opts Options
+
+	// sweep serializes collections so each sees the counters of the last.
+	sweep sync.Mutex
+	mu    sync.RWMutex
+	prev  map[processKey]counters
+}
+
+var defaultCollector = NewCollector(DefaultOptions)
+
+func NewCollector(opts Options) *Collector {
+	return &Collector{opts: opts, prev: make(map[processKey]counters)}
+}
+
+// Collect gathers the details of every running process.
+func (c *Collector) Collect(ctx context.Context) (Snapshot, error) {
+	processInfoList := []Process{}
+	processes, err := process.ProcessesWithContext(ctx) // Mengambil semua proses yang berjalan
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("retrieve processes: %w", err)
+	}
+
+	c.sweep.Lock()
+	defer c.sweep.Unlock()
+	c.mu.RLock()
+	prev := c.prev
+	c.mu.RUnlock()
+
+	prevByPid := make(map[int32]processKey, len(prev))
+	for key := range prev {
+		prevByPid[key.pid] = key
+	}
+
+	// Menggunakan WaitGroup untuk paralelisme
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	current := make(map[processKey]counters, len(processes))
+
+	for _, proc := range processes {
+		wg.Add(1)
+		go func(proc *process.Process) {
+			defer wg.Done()
+			processInfo, cur := getProcessDetails(ctx, proc, c.opts.PerProcessTimeout, c.opts.Heavy)
+			key := processKey{pid: processInfo.Pid, createTime: processInfo.CreateTime}
+			known := true
+			if processInfo.CreateTime == 0 {
+				// Reading the create time failed this time. Keep the identity
+				// the pid had in the last collection rather than starting
+				// over under a key no later collection will match; a pid not
+				// seen before gets no rates until its create time is read.
+				key, known = prevByPid[processInfo.Pid]
+				processInfo.CreateTime = key.createTime
+			}
+			if known {
+				applyRates(&processInfo, prev[key], cur)
+			}
+
+			mu.Lock()
+			processInfoList = append(processInfoList, processInfo)
+			if known {
+				current[key] = cur
+			}
+			mu.Unlock()
+		}(proc)
+	}
+
+	wg.Wait()
+	// Exited processes are dropped along with the old map.
+	c.mu.Lock()
+	c.prev = current
+	c.mu.Unlock()
+	return Snapshot{Processes: processInfoList}, nil
+}
+
+// previous returns the counters of the last collection for the process.
+func (c *Collector) previous(pid int32, createTime int64) counters {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.prev[processKey{pid: pid, createTime: createTime}]
+}
+
+// applyRates sets the CPU percent and rates of info from the change
+// between prev and cur. Without a previous sample the process's start is
+// the baseline, with all counters at zero.
+func applyRates(info *Process, prev, cur counters) {
+	if prev.at.IsZero() {
+		if info.CreateTime == 0 {
+			return
+		}
+		prev = counters{at: time.UnixMilli(info.CreateTime), hasCPU: true, io: &process.IOCountersStat{}, faults: &process.PageFaultsStat{}}
+	}
+
+	elapsed := cur.at.Sub(prev.at).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	rate := func(before, after uint64) float64 {
+		if after < before {
+			return 0
+		}
+		return float64(after-before) / elapsed
+	}
+
+	if prev.hasCPU && cur.hasCPU && cur.cpu >= prev.cpu {
+		info.CPUPercent = 100 * (cur.cpu - prev.cpu) / elapsed
+	}
+	if prev.io != nil && cur.io != nil {
+		info.IORates = &IORates{
+			ReadCount:  rate(prev.io.ReadCount, cur.io.ReadCount),
+			WriteCount: rate(prev.io.WriteCount, cur.io.WriteCount),
+			ReadBytes:  rate(prev.io.ReadBytes, cur.io.ReadBytes),
+			WriteBytes: rate(prev.io.WriteBytes, cur.io.WriteBytes),
+		}
+	}
+	if prev.faults != nil && cur.faults != nil {
+		info.PageFaultRates = &PageFaultRates{
+			Minor: rate(prev.faults.MinorFaults, cur.faults.MinorFaults),
+			Major: rate(prev.faults.MajorFaults, cur.faults.MajorFaults),
+		}
+	}
+}
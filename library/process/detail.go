@@ -0,0 +1,258 @@
+package processinfo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shirou/gopsutil/v4/cpu"
+	"github.com/shirou/gopsutil/v4/process"
+)
+
+// ErrNotFound is returned for a pid with no running process.
+var ErrNotFound = errors.New("process not found")
+
+// ErrEnvironDisabled is returned for a detail request asking for the
+// environment from a collector that does not allow it.
+var ErrEnvironDisabled = errors.New("env: the process environment is disabled")
+
+// maxTreeDepth bounds the depth of the children tree of a detail.
+const maxTreeDepth = 32
+
+// ChildNode is a process in the children tree of a Detail.
+type ChildNode struct {
+	Pid      int32       `json:"pid"`
+	Name     string      `json:"name,omitempty"`
+	Children []ChildNode `json:"children,omitempty"`
+}
+
+// MemoryMapsSummary totals the memory mappings of a process. Sizes are in
+// kB, as in /proc/<pid>/smaps.
+type MemoryMapsSummary struct {
+	Count        int    `json:"count"`
+	Size         uint64 `json:"size"`
+	Rss          uint64 `json:"rss"`
+	Pss          uint64 `json:"pss"`
+	SharedClean  uint64 `json:"shared_clean"`
+	SharedDirty  uint64 `json:"shared_dirty"`
+	PrivateClean uint64 `json:"private_clean"`
+	PrivateDirty uint64 `json:"private_dirty"`
+	Anonymous    uint64 `json:"anonymous"`
+	Swap         uint64 `json:"swap"`
+}
+
+// Detail is everything known about a single process, including the heavy
+// fields. Fields that could not be read are left empty.
+type Detail struct {
+	Process
+	CmdlineArgs    []string                    `json:"cmdline_args,omitempty"`
+	Cwd            string                      `json:"cwd,omitempty"`
+	Terminal       string                      `json:"terminal,omitempty"`
+	Uids           []uint32                    `json:"uids,omitempty"`
+	Gids           []uint32                    `json:"gids,omitempty"`
+	Groups         []uint32                    `json:"groups,omitempty"`
+	IONice         int32                       `json:"ionice"`
+	CPUAffinity    []int32                     `json:"cpu_affinity,omitempty"`
+	Times          *cpu.TimesStat              `json:"times,omitempty"`
+	Rlimits        []process.RlimitStat        `json:"rlimits,omitempty"`
+	IOCounters     *process.IOCountersStat     `json:"io_counters,omitempty"`
+	NumCtxSwitches *process.NumCtxSwitchesStat `json:"num_ctx_switches,omitempty"`
+	PageFaults     *process.PageFaultsStat     `json:"page_faults,omitempty"`
+	MemoryInfoEx   *process.MemoryInfoExStat   `json:"memory_info_ex,omitempty"`
+	MemoryMaps     *MemoryMapsSummary          `json:"memory_maps,omitempty"`
+	Environ        []string                    `json:"environ,omitempty"`
+	// Children replaces the flat child list of Process with the full tree.
+	Children []ChildNode `json:"children,omitempty"`
+}
+
+// DetailOptions controls a single-process collection.
+type DetailOptions struct {
+	// Environ includes the environment, which may hold secrets.
+	Environ bool
+	Timeout time.Duration
+}
+
+var DefaultDetailOptions = DetailOptions{Timeout: 5 * time.Second}
+
+// CollectDetail gathers everything about the process pid. It returns
+// ErrNotFound if there is no such process.
+func CollectDetail(ctx context.Context, pid int32, opts DetailOptions) (Detail, error) {
+	return defaultCollector.Detail(ctx, pid, opts)
+}
+
+// Detail gathers everything about the process pid, with rates relative
+// to the collector's last collection. It returns ErrNotFound if there is
+// no such process.
+func (c *Collector) Detail(ctx context.Context, pid int32, opts DetailOptions) (Detail, error) {
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	proc, err := process.NewProcessWithContext(ctx, pid)
+	if err != nil {
+		if errors.Is(err, process.ErrorProcessNotRunning) {
+			return Detail{}, fmt.Errorf("%w: %d", ErrNotFound, pid)
+		}
+		return Detail{}, err
+	}
+
+	info, cur := getProcessDetails(ctx, proc, opts.Timeout, HeavyFields)
+	applyRates(&info, c.previous(pid, info.CreateTime), cur)
+
+	d := Detail{Process: info}
+	if args, err := proc.CmdlineSliceWithContext(ctx); err == nil {
+		d.CmdlineArgs = args
+	}
+	if cwd, err := proc.CwdWithContext(ctx); err == nil {
+		d.Cwd = cwd
+	}
+	if terminal, err := proc.TerminalWithContext(ctx); err == nil {
+		d.Terminal = terminal
+	}
+	if uids, err := proc.UidsWithContext(ctx); err == nil {
+		d.Uids = uids
+	}
+	if gids, err := proc.GidsWithContext(ctx); err == nil {
+		d.Gids = gids
+	}
+	if groups, err := proc.GroupsWithContext(ctx); err == nil {
+		d.Groups = groups
+	}
+	if ionice, err := proc.IOniceWithContext(ctx); err == nil {
+		d.IONice = ionice
+	}
+	if affinity, err := proc.CPUAffinityWithContext(ctx); err == nil {
+		d.CPUAffinity = affinity
+	}
+	if times, err := proc.TimesWithContext(ctx); err == nil {
+		d.Times = times
+	}
+	if rlimits, err := proc.RlimitUsageWithContext(ctx, true); err == nil {
+		d.Rlimits = rlimits
+	}
+	d.IOCounters = cur.io
+	if switches, err := proc.NumCtxSwitchesWithContext(ctx); err == nil {
+		d.NumCtxSwitches = switches
+	}
+	d.PageFaults = cur.faults
+	if memEx, err := proc.MemoryInfoExWithContext(ctx); err == nil {
+		d.MemoryInfoEx = memEx
+	}
+	if maps, err := proc.MemoryMapsWithContext(ctx, false); err == nil && maps != nil {
+		d.MemoryMaps = summarizeMemoryMaps(*maps)
+	}
+	if opts.Environ {
+		if environ, err := proc.EnvironWithContext(ctx); err == nil {
+			d.Environ = environ
+		}
+	}
+	d.Children = childTree(ctx, proc, map[int32]bool{pid: true}, 0)
+
+	// The process may have exited while it was being read.
+	if running, err := proc.IsRunningWithContext(ctx); err == nil && !running {
+		return Detail{}, fmt.Errorf("%w: %d", ErrNotFound, pid)
+	}
+	return d, nil
+}
+
+// Exists reports whether a process with pid is running. Errors checking
+// are reported as existing so callers fall through to a full read.
+func Exists(ctx context.Context, pid int32) bool {
+	exists, err := process.PidExistsWithContext(ctx, pid)
+	return exists || err != nil
+}
+
+// childTree returns the descendants of proc. seen guards against pid reuse
+// turning the tree into a cycle.
+func childTree(ctx context.Context, proc *process.Process, seen map[int32]bool, depth int) []ChildNode {
+	if depth >= maxTreeDepth {
+		return nil
+	}
+	children, err := proc.ChildrenWithContext(ctx)
+	if err != nil {
+		return nil
+	}
+
+	var nodes []ChildNode
+	for _, child := range children {
+		if seen[child.Pid] {
+			continue
+		}
+		seen[child.Pid] = true
+
+		node := ChildNode{Pid: child.Pid}
+		if name, err := child.NameWithContext(ctx); err == nil {
+			node.Name = name
+		}
+		node.Children = childTree(ctx, child, seen, depth+1)
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+// ParseDetailRequest reads the pid path parameter and the env query
+// parameter of a detail request for the default collector, which does not
+// allow the environment.
+func ParseDetailRequest(c *gin.Context) (int32, DetailOptions, error) {
+	return defaultCollector.ParseDetailRequest(c)
+}
+
+// ParseDetailRequest reads the pid path parameter and the env query
+// parameter of a detail request. It returns ErrEnvironDisabled for env=true
+// unless col allows the environment.
+func (col *Collector) ParseDetailRequest(c *gin.Context) (int32, DetailOptions, error) {
+	opts := DefaultDetailOptions
+
+	pid, err := strconv.ParseInt(c.Param("pid"), 10, 32)
+	if err != nil || pid <= 0 {
+		return 0, opts, fmt.Errorf("invalid pid %q", c.Param("pid"))
+	}
+	if v := c.Query("env"); v != "" {
+		if opts.Environ, err = strconv.ParseBool(v); err != nil {
+			return 0, opts, fmt.Errorf("env: invalid boolean %q", v)
+		}
+	}
+	if opts.Environ && !col.opts.AllowEnviron {
+		return 0, opts, ErrEnvironDisabled
+	}
+	return int32(pid), opts, nil
+}
+
+// DetailRequestStatus is the HTTP status for an error of
+// ParseDetailRequest.
+func DetailRequestStatus(err error) int {
+	if errors.Is(err, ErrEnvironDisabled) {
+		return http.StatusForbidden
+	}
+	return http.StatusBadRequest
+}
+
+// GetProcessDetail returns everything about the process in the pid path
+// parameter as JSON
+func GetProcessDetail(c *gin.Context) {
+	defaultCollector.GetProcessDetail(c)
+}
+
+// GetProcessDetail is GetProcessDetail with rates relative to col's last
+// collection; the environment is included with env=true if col allows it
+func (col *Collector) GetProcessDetail(c *gin.Context) {
+	pid, opts, err := col.ParseDetailRequest(c)
+	if err != nil {
+		c.JSON(DetailRequestStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	detail, err := col.Detail(c.Request.Context(), pid, opts)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, detail)
+}
@@ -0,0 +1,64 @@
+package processinfo
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func detailContext(pid, query string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/metrics/process/"+pid+query, nil)
+	c.Params = gin.Params{{Key: "pid", Value: pid}}
+	return c
+}
+
+func TestParseDetailRequest(t *testing.T) {
+	allowed := NewCollector(Options{AllowEnviron: true})
+	denied := NewCollector(DefaultOptions)
+
+	for _, tt := range []struct {
+		name        string
+		col         *Collector
+		pid, query  string
+		wantPid     int32
+		wantEnviron bool
+		wantStatus  int // of the error, 0 without one
+	}{
+		{"pid", denied, "42", "", 42, false, 0},
+		{"zero pid", denied, "0", "", 0, false, http.StatusBadRequest},
+		{"negative pid", denied, "-1", "", 0, false, http.StatusBadRequest},
+		{"pid out of range", denied, "4294967296", "", 0, false, http.StatusBadRequest},
+		{"not a pid", denied, "init", "", 0, false, http.StatusBadRequest},
+		{"invalid env", allowed, "42", "?env=maybe", 0, false, http.StatusBadRequest},
+		{"env=false", denied, "42", "?env=false", 42, false, 0},
+		{"env disabled", denied, "42", "?env=true", 0, false, http.StatusForbidden},
+		{"env allowed", allowed, "42", "?env=true", 42, true, 0},
+	} {
+		pid, opts, err := tt.col.ParseDetailRequest(detailContext(tt.pid, tt.query))
+		if tt.wantStatus != 0 {
+			if err == nil {
+				t.Errorf("%s: no error, want status %d", tt.name, tt.wantStatus)
+			} else if status := DetailRequestStatus(err); status != tt.wantStatus {
+				t.Errorf("%s: status = %d, want %d (err %v)", tt.name, status, tt.wantStatus, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if pid != tt.wantPid || opts.Environ != tt.wantEnviron {
+			t.Errorf("%s: pid = %d, environ = %v, want %d, %v", tt.name, pid, opts.Environ, tt.wantPid, tt.wantEnviron)
+		}
+	}
+}
+
+func TestDefaultCollectorDeniesEnviron(t *testing.T) {
+	if _, _, err := ParseDetailRequest(detailContext("1", "?env=1")); !errors.Is(err, ErrEnvironDisabled) {
+		t.Errorf("err = %v, want ErrEnvironDisabled", err)
+	}
+}
@@ -0,0 +1,190 @@
+package processinfo
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"checker/library/stream"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shirou/gopsutil/v4/process"
+)
+
+const (
+	EventStart = "start"
+	EventExit  = "exit"
+)
+
+// maxRecentEvents is how many events Lifecycle keeps for Recent.
+const maxRecentEvents = 1000
+
+// Event is a process seen starting or exiting between two collections.
+type Event struct {
+	Type       string    `json:"type"`
+	Time       time.Time `json:"time"`
+	Pid        int32     `json:"pid"`
+	Ppid       int32     `json:"ppid"`
+	Name       string    `json:"name,omitempty"`
+	Exe        string    `json:"exe,omitempty"`
+	Cmdline    string    `json:"cmdline,omitempty"`
+	Username   string    `json:"username,omitempty"`
+	CreateTime int64     `json:"create_time"`
+
+	// Exit events carry the usage from the last collection the process was
+	// seen in, and its lifetime up to the collection that missed it.
+	LastSeen   *time.Time              `json:"last_seen,omitempty"`
+	Lifetime   float64                 `json:"lifetime_seconds,omitempty"`
+	CPUPercent float64                 `json:"cpu_percent,omitempty"`
+	MemoryInfo *process.MemoryInfoStat `json:"memory_info,omitempty"`
+	NumThreads int32                   `json:"num_threads,omitempty"`
+	NumFDs     int32                   `json:"num_fds,omitempty"`
+}
+
+// Lifecycle derives start and exit events from successive collections.
+// Processes that start and exit between two collections are not seen.
+type Lifecycle struct {
+	hub *stream.Hub
+
+	mu       sync.Mutex
+	prev     map[processKey]Process
+	prevTime time.Time
+	recent   []Event
+}
+
+func NewLifecycle() *Lifecycle {
+	return &Lifecycle{hub: stream.NewHub()}
+}
+
+// Hub publishes every event as it is detected.
+func (l *Lifecycle) Hub() *stream.Hub {
+	return l.hub
+}
+
+// Observe compares snap, collected at t, with the previous collection and
+// publishes the resulting events. The first collection only sets the
+// baseline.
+func (l *Lifecycle) Observe(t time.Time, snap Snapshot) []Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	prevByPid := make(map[int32]processKey, len(l.prev))
+	for key := range l.prev {
+		prevByPid[key.pid] = key
+	}
+
+	current := make(map[processKey]Process, len(snap.Processes))
+	for _, p := range snap.Processes {
+		if p.CreateTime == 0 {
+			// Reading the create time failed this time. Assume the process
+			// seen under this pid before is still running rather than
+			// reporting it as exited and started again; without a previous
+			// key it cannot be told apart from a later process reusing
+			// its pid, so it is left out.
+			key, ok := prevByPid[p.Pid]
+			if !ok {
+				continue
+			}
+			p.CreateTime = key.createTime
+			current[key] = p
+			continue
+		}
+		current[processKey{pid: p.Pid, createTime: p.CreateTime}] = p
+	}
+
+	var starts, exits []Event
+	if l.prev != nil {
+		for key, p := range current {
+			if _, ok := l.prev[key]; !ok {
+				starts = append(starts, newEvent(EventStart, t, p))
+			}
+		}
+		for key, p := range l.prev {
+			if _, ok := current[key]; ok {
+				continue
+			}
+			e := newEvent(EventExit, t, p)
+			lastSeen := l.prevTime
+			e.LastSeen = &lastSeen
+			e.Lifetime = t.Sub(time.UnixMilli(p.CreateTime)).Seconds()
+			e.CPUPercent = p.CPUPercent
+			e.MemoryInfo = p.MemoryInfo
+			e.NumThreads = p.NumThreads
+			e.NumFDs = p.NumFDs
+			exits = append(exits, e)
+		}
+	}
+	l.prev, l.prevTime = current, t
+
+	sort.Slice(starts, func(i, j int) bool { return starts[i].Pid < starts[j].Pid })
+	sort.Slice(exits, func(i, j int) bool { return exits[i].Pid < exits[j].Pid })
+	events := append(starts, exits...)
+
+	l.recent = append(l.recent, events...)
+	if over := len(l.recent) - maxRecentEvents; over > 0 {
+		l.recent = append([]Event(nil), l.recent[over:]...)
+	}
+	for _, e := range events {
+		l.hub.Publish(e)
+	}
+	return events
+}
+
+func newEvent(typ string, t time.Time, p Process) Event {
+	return Event{
+		Type:       typ,
+		Time:       t,
+		Pid:        p.Pid,
+		Ppid:       p.Ppid,
+		Name:       p.Name,
+		Exe:        p.Exe,
+		Cmdline:    p.Cmdline,
+		Username:   p.Username,
+		CreateTime: p.CreateTime,
+	}
+}
+
+// Recent returns the most recent events, oldest first, optionally only
+// those of one type.
+func (l *Lifecycle) Recent(typ string) []Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	events := []Event{}
+	for _, e := range l.recent {
+		if typ == "" || e.Type == typ {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// Handler serves the recent events, filtered by the type and pid query
+// parameters.
+func (l *Lifecycle) Handler(c *gin.Context) {
+	typ := c.Query("type")
+	if typ != "" && typ != EventStart && typ != EventExit {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("type: must be %s or %s", EventStart, EventExit)})
+		return
+	}
+
+	events := l.Recent(typ)
+	if v := c.Query("pid"); v != "" {
+		pid, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("pid: invalid pid %q", v)})
+			return
+		}
+		filtered := []Event{}
+		for _, e := range events {
+			if e.Pid == int32(pid) {
+				filtered = append(filtered, e)
+			}
+		}
+		events = filtered
+	}
+	c.JSON(http.StatusOK, events)
+}
@@ -0,0 +1,19 @@
+package processinfo
+
+import "github.com/shirou/gopsutil/v4/process"
+
+func summarizeMemoryMaps(maps []process.MemoryMapsStat) *MemoryMapsSummary {
+	s := &MemoryMapsSummary{Count: len(maps)}
+	for _, m := range maps {
+		s.Size += m.Size
+		s.Rss += m.Rss
+		s.Pss += m.Pss
+		s.SharedClean += m.SharedClean
+		s.SharedDirty += m.SharedDirty
+		s.PrivateClean += m.PrivateClean
+		s.PrivateDirty += m.PrivateDirty
+		s.Anonymous += m.Anonymous
+		s.Swap += m.Swap
+	}
+	return s
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package processinfo
+
+import "github.com/shirou/gopsutil/v4/process"
+
+// summarizeMemoryMaps only counts the mappings where gopsutil does not
+// report their sizes.
+func summarizeMemoryMaps(maps []process.MemoryMapsStat) *MemoryMapsSummary {
+	return &MemoryMapsSummary{Count: len(maps)}
+}
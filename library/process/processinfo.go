@@ -2,92 +2,204 @@ package processinfo
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"sync"
 	"time"
 
+	cgroupinfo "checker/library/cgroup"
+
 	"github.com/gin-gonic/gin"
+	"github.com/shirou/gopsutil/v4/cpu"
+	"github.com/shirou/gopsutil/v4/net"
 	"github.com/shirou/gopsutil/v4/process"
 )
 
-// GetProcessInfo retrieves process information and returns it as JSON
+// ProcessRef identifies a related process, e.g. a child.
+type ProcessRef struct {
+	Pid int32 `json:"pid"`
+}
+
+// Heavy fields are expensive to read and only collected when asked for.
+const (
+	FieldThreads     = "threads"
+	FieldOpenFiles   = "open_files"
+	FieldConnections = "connections"
+)
+
+var HeavyFields = []string{FieldThreads, FieldOpenFiles, FieldConnections}
+
+// Process holds the details of a single process. Fields that could not be
+// read are left empty.
+type Process struct {
+	Pid           int32                   `json:"pid"`
+	Ppid          int32                   `json:"ppid"`
+	Name          string                  `json:"name,omitempty"`
+	Exe           string                  `json:"exe,omitempty"`
+	Cmdline       string                  `json:"cmdline,omitempty"`
+	Username      string                  `json:"username,omitempty"`
+	MemoryInfo    *process.MemoryInfoStat `json:"memory_info,omitempty"`
+	MemoryPercent float32                 `json:"memory_percent"`
+	// CPUPercent, IORates and PageFaultRates cover the time since the
+	// previous collection, or since the process started if it had not been
+	// seen before.
+	CPUPercent     float64                  `json:"cpu_percent"`
+	IORates        *IORates                 `json:"io_rates,omitempty"`
+	PageFaultRates *PageFaultRates          `json:"page_fault_rates,omitempty"`
+	CreateTime     int64                    `json:"create_time,omitempty"`
+	Cgroup         string                   `json:"cgroup,omitempty"`
+	ContainerID    string                   `json:"container_id,omitempty"`
+	NumThreads     int32                    `json:"num_threads,omitempty"`
+	NumFDs         int32                    `json:"num_fds,omitempty"`
+	Status         []string                 `json:"status,omitempty"`
+	Nice           int32                    `json:"nice"`
+	Threads        map[int32]*cpu.TimesStat `json:"threads,omitempty"`
+	OpenFiles      []process.OpenFilesStat  `json:"open_files,omitempty"`
+	Children       []ProcessRef             `json:"children,omitempty"`
+	Connections    []net.ConnectionStat     `json:"connections,omitempty"`
+}
+
+// Snapshot is a point-in-time view of all running processes.
+type Snapshot struct {
+	Processes []Process `json:"processes"`
+}
+
+// Options controls a process collection.
+type Options struct {
+	// PerProcessTimeout bounds the time spent reading one process.
+	PerProcessTimeout time.Duration
+	// Heavy lists the heavy fields to collect; none by default.
+	Heavy []string
+	// AllowEnviron lets detail requests ask for the environment, which
+	// may hold secrets.
+	AllowEnviron bool
+}
+
+var DefaultOptions = Options{PerProcessTimeout: 500 * time.Millisecond}
+
+// Collect gathers the details of every running process, with rates
+// relative to the previous call
+func Collect(ctx context.Context) (Snapshot, error) {
+	return defaultCollector.Collect(ctx)
+}
+
+// CollectWithOptions gathers the details of every running process once,
+// with rates covering each process's whole lifetime
+func CollectWithOptions(ctx context.Context, opts Options) (Snapshot, error) {
+	return NewCollector(opts).Collect(ctx)
+}
+
+// GetProcessInfo retrieves process information and returns it as JSON,
+// filtered and paged by the query parameters described in ParseQuery
 func GetProcessInfo(c *gin.Context) {
-	processInfoList := []map[string]interface{}{}
-	processes, err := process.Processes() // Mengambil semua proses yang berjalan
+	snap, err := Collect(c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve processes"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-
-	// Menggunakan WaitGroup untuk paralelisme
-	var wg sync.WaitGroup
-	var mu sync.Mutex
-
-	for _, proc := range processes {
-		wg.Add(1)
-		go func(proc *process.Process) {
-			defer wg.Done()
-			processInfo := getProcessDetails(proc)
-			mu.Lock()
-			processInfoList = append(processInfoList, processInfo)
-			mu.Unlock()
-		}(proc)
-	}
-
-	wg.Wait()
-	c.JSON(http.StatusOK, processInfoList)
+	Respond(c, snap, DefaultOptions.PerProcessTimeout)
 }
 
-// getProcessDetails collects detailed information of a single process
-func getProcessDetails(proc *process.Process) map[string]interface{} {
-	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+// getProcessDetails collects detailed information of a single process,
+// along with the counters its rates are computed from
+func getProcessDetails(ctx context.Context, proc *process.Process, timeout time.Duration, heavy []string) (Process, counters) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	info := make(map[string]interface{})
+	info := Process{Pid: proc.Pid}
 
 	// Mendapatkan berbagai informasi proses
-	if pid, err := proc.PpidWithContext(ctx); err == nil {
-		info["pid"] = pid
+	if ppid, err := proc.PpidWithContext(ctx); err == nil {
+		info.Ppid = ppid
 	}
 	if name, err := proc.NameWithContext(ctx); err == nil {
-		info["name"] = name
+		info.Name = name
 	}
 	if exe, err := proc.ExeWithContext(ctx); err == nil {
-		info["exe"] = exe
+		info.Exe = exe
 	}
 	if cmdline, err := proc.CmdlineWithContext(ctx); err == nil {
-		info["cmdline"] = cmdline
+		info.Cmdline = cmdline
+	}
+	if username, err := proc.UsernameWithContext(ctx); err == nil {
+		info.Username = username
 	}
 	if memInfo, err := proc.MemoryInfoWithContext(ctx); err == nil {
-		info["memory_info"] = memInfo
+		info.MemoryInfo = memInfo
 	}
-	if cpuPercent, err := proc.CPUPercentWithContext(ctx); err == nil {
-		info["cpu_percent"] = cpuPercent
+	if memPercent, err := proc.MemoryPercentWithContext(ctx); err == nil {
+		info.MemoryPercent = memPercent
 	}
 	if createTime, err := proc.CreateTimeWithContext(ctx); err == nil {
-		info["create_time"] = createTime
+		info.CreateTime = createTime
+	}
+	if cgroup, err := cgroupinfo.ReadProcessCgroup(fmt.Sprintf("/proc/%d/cgroup", proc.Pid)); err == nil {
+		info.Cgroup = cgroup
+		info.ContainerID = cgroupinfo.ContainerID(cgroup)
 	}
 	if numThreads, err := proc.NumThreadsWithContext(ctx); err == nil {
-		info["num_threads"] = numThreads
+		info.NumThreads = numThreads
+	}
+	if numFDs, err := proc.NumFDsWithContext(ctx); err == nil {
+		info.NumFDs = numFDs
 	}
 	if status, err := proc.StatusWithContext(ctx); err == nil {
-		info["status"] = status
+		info.Status = status
 	}
 	if nice, err := proc.NiceWithContext(ctx); err == nil {
-		info["nice"] = nice
-	}
-	if threads, err := proc.ThreadsWithContext(ctx); err == nil {
-		info["threads"] = threads
-	}
-	if openFiles, err := proc.OpenFilesWithContext(ctx); err == nil {
-		info["open_files"] = openFiles
+		info.Nice = nice
 	}
 	if children, err := proc.ChildrenWithContext(ctx); err == nil {
-		info["children"] = children
+		for _, child := range children {
+			info.Children = append(info.Children, ProcessRef{Pid: child.Pid})
+		}
 	}
-	if connections, err := proc.ConnectionsWithContext(ctx); err == nil {
-		info["connections"] = connections
+
+	getHeavyFields(ctx, proc, &info, heavy)
+	return info, readCounters(ctx, proc)
+}
+
+// getHeavyFields reads the requested heavy fields of proc into info.
+func getHeavyFields(ctx context.Context, proc *process.Process, info *Process, heavy []string) {
+	for _, field := range heavy {
+		switch field {
+		case FieldThreads:
+			if threads, err := proc.ThreadsWithContext(ctx); err == nil {
+				info.Threads = threads
+			}
+		case FieldOpenFiles:
+			if openFiles, err := proc.OpenFilesWithContext(ctx); err == nil {
+				info.OpenFiles = openFiles
+			}
+		case FieldConnections:
+			if connections, err := proc.ConnectionsWithContext(ctx); err == nil {
+				info.Connections = connections
+			}
+		}
 	}
+}
+
+// FetchHeavy fills in the requested heavy fields of procs, reading each
+// process again. Processes that have exited since are left unchanged.
+func FetchHeavy(ctx context.Context, procs []Process, heavy []string, timeout time.Duration) {
+	if len(heavy) == 0 {
+		return
+	}
+
+	var wg sync.WaitGroup
+	for i := range procs {
+		wg.Add(1)
+		go func(info *Process) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
 
-	return info
+			proc, err := process.NewProcessWithContext(ctx, info.Pid)
+			if err != nil {
+				return
+			}
+			getHeavyFields(ctx, proc, info, heavy)
+		}(&procs[i])
+	}
+	wg.Wait()
 }
@@ -0,0 +1,278 @@
+package processinfo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Query filters, sorts and pages a process list. The zero Query returns
+// every process sorted by pid.
+type Query struct {
+	// Name matches the process name.
+	Name *regexp.Regexp
+	User string
+	// Status matches any of the process states, e.g. "running".
+	Status string
+	// Container is a prefix of the container ID, so short IDs work too.
+	Container string
+	// Cgroup is a cgroup path prefix, e.g. "/system.slice".
+	Cgroup string
+	// MinCPU and MinMemory are lower bounds on cpu_percent and
+	// memory_percent.
+	MinCPU    float64
+	MinMemory float64
+	// Fields restricts the output to these JSON fields; pid is always
+	// included. Heavy fields are fetched only when listed here.
+	Fields []string
+	// Sort is a sort key; Desc reverses the order.
+	Sort   string
+	Desc   bool
+	Limit  int
+	Offset int
+}
+
+// sortKeys are the keys a process list can be sorted by.
+var sortKeys = map[string]func(a, b *Process) bool{
+	"pid":            func(a, b *Process) bool { return a.Pid < b.Pid },
+	"name":           func(a, b *Process) bool { return a.Name < b.Name },
+	"cpu_percent":    func(a, b *Process) bool { return a.CPUPercent < b.CPUPercent },
+	"memory_percent": func(a, b *Process) bool { return a.MemoryPercent < b.MemoryPercent },
+	"rss":            func(a, b *Process) bool { return rss(a) < rss(b) },
+	"create_time":    func(a, b *Process) bool { return a.CreateTime < b.CreateTime },
+	"num_threads":    func(a, b *Process) bool { return a.NumThreads < b.NumThreads },
+	"num_fds":        func(a, b *Process) bool { return a.NumFDs < b.NumFDs },
+}
+
+func rss(p *Process) uint64 {
+	if p.MemoryInfo == nil {
+		return 0
+	}
+	return p.MemoryInfo.RSS
+}
+
+// fieldNames are the JSON names of the Process fields.
+var fieldNames = func() map[string]bool {
+	names := make(map[string]bool)
+	t := reflect.TypeOf(Process{})
+	for i := 0; i < t.NumField(); i++ {
+		if tag := t.Field(i).Tag.Get("json"); tag != "" {
+			names[strings.Split(tag, ",")[0]] = true
+		}
+	}
+	return names
+}()
+
+// ParseQuery reads a query from URL parameters:
+//
+//	name=regex user=name status=running min_cpu=5 min_mem=1
+//	container=3f2a9c cgroup=/system.slice
+//	fields=pid,name,threads sort=-cpu_percent limit=20 offset=40 top=10
+//
+// A leading "-" on sort orders descending. top=N is shorthand for the N
+// processes using the most CPU, or the most of the sort key if given.
+// Other parameters are ignored.
+func ParseQuery(values url.Values) (Query, error) {
+	var q Query
+
+	if v := values.Get("name"); v != "" {
+		re, err := regexp.Compile(v)
+		if err != nil {
+			return Query{}, fmt.Errorf("name: %v", err)
+		}
+		q.Name = re
+	}
+	q.User = values.Get("user")
+	q.Status = values.Get("status")
+	q.Container = values.Get("container")
+	q.Cgroup = values.Get("cgroup")
+
+	for param, field := range map[string]*float64{"min_cpu": &q.MinCPU, "min_mem": &q.MinMemory} {
+		if v := values.Get(param); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return Query{}, fmt.Errorf("%s: invalid number %q", param, v)
+			}
+			*field = f
+		}
+	}
+
+	if v := values.Get("fields"); v != "" {
+		for _, field := range strings.Split(v, ",") {
+			field = strings.TrimSpace(field)
+			if !fieldNames[field] {
+				return Query{}, fmt.Errorf("fields: unknown field %q", field)
+			}
+			q.Fields = append(q.Fields, field)
+		}
+	}
+
+	q.Sort = "pid"
+	if v := values.Get("sort"); v != "" {
+		q.Sort, q.Desc = strings.TrimPrefix(v, "-"), strings.HasPrefix(v, "-")
+		if sortKeys[q.Sort] == nil {
+			return Query{}, fmt.Errorf("sort: unknown key %q", q.Sort)
+		}
+	}
+
+	for param, field := range map[string]*int{"limit": &q.Limit, "offset": &q.Offset} {
+		if v := values.Get(param); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return Query{}, fmt.Errorf("%s: must be a non-negative integer", param)
+			}
+			*field = n
+		}
+	}
+
+	if v := values.Get("top"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return Query{}, fmt.Errorf("top: must be a positive integer")
+		}
+		if values.Get("sort") == "" {
+			q.Sort = "cpu_percent"
+		}
+		q.Desc = true
+		q.Limit, q.Offset = n, 0
+	}
+	return q, nil
+}
+
+// Heavy returns the heavy fields the query asks for.
+func (q Query) Heavy() []string {
+	var heavy []string
+	for _, field := range HeavyFields {
+		for _, f := range q.Fields {
+			if f == field {
+				heavy = append(heavy, field)
+			}
+		}
+	}
+	return heavy
+}
+
+func (q Query) match(p *Process) bool {
+	if q.Name != nil && !q.Name.MatchString(p.Name) {
+		return false
+	}
+	if q.User != "" && p.Username != q.User {
+		return false
+	}
+	if q.Container != "" && (p.ContainerID == "" || !strings.HasPrefix(p.ContainerID, q.Container)) {
+		return false
+	}
+	if q.Cgroup != "" && !strings.HasPrefix(p.Cgroup, q.Cgroup) {
+		return false
+	}
+	if q.Status != "" {
+		found := false
+		for _, s := range p.Status {
+			if strings.EqualFold(s, q.Status) {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return p.CPUPercent >= q.MinCPU && float64(p.MemoryPercent) >= q.MinMemory
+}
+
+// Apply filters, sorts and pages procs. It returns the selected page and
+// the number of processes matching the filters.
+func (q Query) Apply(procs []Process) ([]Process, int) {
+	matched := make([]Process, 0, len(procs))
+	for i := range procs {
+		if q.match(&procs[i]) {
+			matched = append(matched, procs[i])
+		}
+	}
+
+	less := sortKeys[q.Sort]
+	if less == nil {
+		less = sortKeys["pid"]
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		if q.Desc {
+			return less(&matched[j], &matched[i])
+		}
+		return less(&matched[i], &matched[j])
+	})
+
+	total := len(matched)
+	if q.Offset >= total {
+		return []Process{}, total
+	}
+	matched = matched[q.Offset:]
+	if q.Limit > 0 && q.Limit < len(matched) {
+		matched = matched[:q.Limit]
+	}
+	return matched, total
+}
+
+// Select returns procs restricted to the query's fields, or procs itself
+// when no fields were asked for.
+func (q Query) Select(procs []Process) (interface{}, error) {
+	if len(q.Fields) == 0 {
+		return procs, nil
+	}
+
+	out := make([]map[string]json.RawMessage, 0, len(procs))
+	for _, p := range procs {
+		data, err := json.Marshal(p)
+		if err != nil {
+			return nil, err
+		}
+		var all map[string]json.RawMessage
+		if err := json.Unmarshal(data, &all); err != nil {
+			return nil, err
+		}
+
+		selected := map[string]json.RawMessage{"pid": all["pid"]}
+		for _, field := range q.Fields {
+			if v, ok := all[field]; ok {
+				selected[field] = v
+			}
+		}
+		out = append(out, selected)
+	}
+	return out, nil
+}
+
+// Run applies the query to snap, fetching any requested heavy fields for
+// the selected processes only.
+func (q Query) Run(ctx context.Context, snap Snapshot, timeout time.Duration) (interface{}, int, error) {
+	page, total := q.Apply(snap.Processes)
+	FetchHeavy(ctx, page, q.Heavy(), timeout)
+	out, err := q.Select(page)
+	return out, total, err
+}
+
+// Respond answers a process query on snap. The number of matching
+// processes before paging is returned in the X-Total-Count header.
+func Respond(c *gin.Context, snap Snapshot, timeout time.Duration) {
+	q, err := ParseQuery(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	out, total, err := q.Run(c.Request.Context(), snap, timeout)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("X-Total-Count", strconv.Itoa(total))
+	c.JSON(http.StatusOK, out)
+}
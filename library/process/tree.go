@@ -0,0 +1,182 @@
+package processinfo
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Usage is the resource usage of a process or of a whole subtree.
+type Usage struct {
+	Processes  int     `json:"processes"`
+	CPUPercent float64 `json:"cpu_percent"`
+	RSS        uint64  `json:"rss"`
+	NumThreads int64   `json:"num_threads"`
+	NumFDs     int64   `json:"num_fds"`
+}
+
+func (u *Usage) add(o Usage) {
+	u.Processes += o.Processes
+	u.CPUPercent += o.CPUPercent
+	u.RSS += o.RSS
+	u.NumThreads += o.NumThreads
+	u.NumFDs += o.NumFDs
+}
+
+// TreeNode is a process with its children. Self is the usage of the
+// process alone and Total that of the process and all its descendants.
+type TreeNode struct {
+	Pid      int32       `json:"pid"`
+	Ppid     int32       `json:"ppid"`
+	Name     string      `json:"name,omitempty"`
+	Username string      `json:"username,omitempty"`
+	Cmdline  string      `json:"cmdline,omitempty"`
+	Self     Usage       `json:"self"`
+	Total    Usage       `json:"total"`
+	Children []*TreeNode `json:"children,omitempty"`
+}
+
+// BuildTree arranges procs into trees by parent pid. Processes whose
+// parent is not in procs become roots. Children and roots are sorted by
+// pid.
+func BuildTree(procs []Process) []*TreeNode {
+	nodes := make(map[int32]*TreeNode, len(procs))
+	for i := range procs {
+		p := &procs[i]
+		nodes[p.Pid] = &TreeNode{
+			Pid:      p.Pid,
+			Ppid:     p.Ppid,
+			Name:     p.Name,
+			Username: p.Username,
+			Cmdline:  p.Cmdline,
+			Self: Usage{
+				Processes:  1,
+				CPUPercent: p.CPUPercent,
+				RSS:        rss(p),
+				NumThreads: int64(p.NumThreads),
+				NumFDs:     int64(p.NumFDs),
+			},
+		}
+	}
+
+	var roots []*TreeNode
+	for _, n := range nodes {
+		parent, ok := nodes[n.Ppid]
+		if !ok || n.Ppid == n.Pid {
+			roots = append(roots, n)
+			continue
+		}
+		parent.Children = append(parent.Children, n)
+	}
+	sortNodes(roots)
+
+	visited := make(map[int32]bool, len(nodes))
+	for _, root := range roots {
+		aggregate(root, visited)
+	}
+
+	// Inconsistent parent pids, e.g. from pid reuse during a sweep, can
+	// form a cycle no root reaches. Break it at its lowest pid.
+	if len(visited) < len(nodes) {
+		var orphans []*TreeNode
+		for pid, n := range nodes {
+			if !visited[pid] {
+				orphans = append(orphans, n)
+			}
+		}
+		sortNodes(orphans)
+		for _, n := range orphans {
+			if visited[n.Pid] {
+				continue
+			}
+			parent := nodes[n.Ppid]
+			for i, child := range parent.Children {
+				if child == n {
+					parent.Children = append(parent.Children[:i], parent.Children[i+1:]...)
+					break
+				}
+			}
+			aggregate(n, visited)
+			roots = append(roots, n)
+		}
+		sortNodes(roots)
+	}
+	return roots
+}
+
+// aggregate sorts the children of n and computes its total usage.
+func aggregate(n *TreeNode, visited map[int32]bool) Usage {
+	visited[n.Pid] = true
+	sortNodes(n.Children)
+
+	n.Total = n.Self
+	children := n.Children[:0]
+	for _, child := range n.Children {
+		if visited[child.Pid] {
+			continue
+		}
+		n.Total.add(aggregate(child, visited))
+		children = append(children, child)
+	}
+	n.Children = children
+	return n.Total
+}
+
+func sortNodes(nodes []*TreeNode) {
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Pid < nodes[j].Pid })
+}
+
+// FindSubtrees returns the topmost nodes in roots for which match is
+// true. Matches nested inside another match are part of its subtree.
+func FindSubtrees(roots []*TreeNode, match func(*TreeNode) bool) []*TreeNode {
+	var found []*TreeNode
+	var walk func(nodes []*TreeNode)
+	walk = func(nodes []*TreeNode) {
+		for _, n := range nodes {
+			if match(n) {
+				found = append(found, n)
+				continue
+			}
+			walk(n.Children)
+		}
+	}
+	walk(roots)
+	return found
+}
+
+// RespondTree answers a process tree request on snap. The root query
+// parameter selects the subtree of one pid and name the subtrees of
+// processes whose name matches the regular expression.
+func RespondTree(c *gin.Context, snap Snapshot) {
+	roots := BuildTree(snap.Processes)
+
+	if v := c.Query("root"); v != "" {
+		pid, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("root: invalid pid %q", v)})
+			return
+		}
+		roots = FindSubtrees(roots, func(n *TreeNode) bool { return n.Pid == int32(pid) })
+		if len(roots) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("%v: %d", ErrNotFound, pid)})
+			return
+		}
+	}
+	if v := c.Query("name"); v != "" {
+		re, err := regexp.Compile(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("name: %v", err)})
+			return
+		}
+		roots = FindSubtrees(roots, func(n *TreeNode) bool { return re.MatchString(n.Name) })
+	}
+
+	if roots == nil {
+		roots = []*TreeNode{}
+	}
+	c.JSON(http.StatusOK, roots)
+}
@@ -0,0 +1,93 @@
+package prometheus
+
+import (
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Metric types of the text exposition format.
+const (
+	Gauge   = "gauge"
+	Counter = "counter"
+)
+
+// Label is a single name="value" pair. Labels are kept in a slice so the
+// output order is stable.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is one value of a metric family.
+type Sample struct {
+	Labels []Label
+	Value  float64
+}
+
+// Family is a named metric with its help text, type and samples.
+type Family struct {
+	Name    string
+	Help    string
+	Type    string
+	Samples []Sample
+}
+
+// Add appends a sample with the given label pairs, e.g.
+// f.Add(1, "cpu", "0", "mode", "user").
+func (f *Family) Add(value float64, labelPairs ...string) {
+	labels := make([]Label, 0, len(labelPairs)/2)
+	for i := 0; i+1 < len(labelPairs); i += 2 {
+		labels = append(labels, Label{Name: labelPairs[i], Value: labelPairs[i+1]})
+	}
+	f.Samples = append(f.Samples, Sample{Labels: labels, Value: value})
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Write renders families in the Prometheus text exposition format
+// (version 0.0.4). Families without samples are skipped.
+func Write(w io.Writer, families []*Family) error {
+	var b strings.Builder
+	for _, f := range families {
+		if len(f.Samples) == 0 {
+			continue
+		}
+
+		b.WriteString("# HELP " + f.Name + " " + helpEscaper.Replace(f.Help) + "\n")
+		b.WriteString("# TYPE " + f.Name + " " + f.Type + "\n")
+		for _, sample := range f.Samples {
+			b.WriteString(f.Name)
+			if len(sample.Labels) > 0 {
+				b.WriteByte('{')
+				for i, label := range sample.Labels {
+					if i > 0 {
+						b.WriteByte(',')
+					}
+					b.WriteString(label.Name + `="` + labelEscaper.Replace(label.Value) + `"`)
+				}
+				b.WriteByte('}')
+			}
+			b.WriteString(" " + formatValue(sample.Value) + "\n")
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,479 @@
+package prometheus
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	cgroupinfo "checker/library/cgroup"
+	cpuinfo "checker/library/cpu"
+	diskinfo "checker/library/disk"
+	gpuinfo "checker/library/gpu"
+	memoryinfo "checker/library/memory"
+	networkinfo "checker/library/network"
+	pressureinfo "checker/library/pressure"
+	"checker/library/sampler"
+	sensorinfo "checker/library/sensor"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	namespace   = "uptimex"
+	ContentType = "text/plain; version=0.0.4; charset=utf-8"
+	mebibyte    = 1024 * 1024
+)
+
+func newFamily(name, typ, help string) *Family {
+	return &Family{Name: namespace + "_" + name, Type: typ, Help: help}
+}
+
+// CPUFamilies maps a CPU snapshot to per-core usage and time metrics.
+func CPUFamilies(snap cpuinfo.Snapshot) []*Family {
+	count := newFamily("cpu_count", Gauge, "Number of CPUs.")
+	count.Add(float64(snap.CountLogical), "type", "logical")
+	count.Add(float64(snap.CountPhysical), "type", "physical")
+
+	percent := newFamily("cpu_usage_percent", Gauge, "CPU usage per core in percent.")
+	for i, p := range snap.PercentPerCore {
+		percent.Add(p, "cpu", strconv.Itoa(i))
+	}
+
+	seconds := newFamily("cpu_seconds_total", Counter, "Seconds the CPUs spent in each mode.")
+	for _, t := range snap.Times {
+		cpu := strings.TrimPrefix(t.CPU, "cpu")
+		seconds.Add(t.User, "cpu", cpu, "mode", "user")
+		seconds.Add(t.System, "cpu", cpu, "mode", "system")
+		seconds.Add(t.Idle, "cpu", cpu, "mode", "idle")
+		seconds.Add(t.Nice, "cpu", cpu, "mode", "nice")
+		seconds.Add(t.Iowait, "cpu", cpu, "mode", "iowait")
+		seconds.Add(t.Irq, "cpu", cpu, "mode", "irq")
+		seconds.Add(t.Softirq, "cpu", cpu, "mode", "softirq")
+		seconds.Add(t.Steal, "cpu", cpu, "mode", "steal")
+	}
+
+	total := newFamily("cpu_usage_total_percent", Gauge, "CPU usage over all cores in percent.")
+	total.Add(snap.Percent)
+	families := []*Family{count, percent, total, seconds}
+
+	if l := snap.Load; l != nil {
+		gauge := func(name, help string, value float64) *Family {
+			f := newFamily(name, Gauge, help)
+			f.Add(value)
+			return f
+		}
+		families = append(families,
+			gauge("load1", "1 minute load average.", l.Load1),
+			gauge("load5", "5 minute load average.", l.Load5),
+			gauge("load15", "15 minute load average.", l.Load15),
+		)
+	}
+	if snap.Topology != nil {
+		freq := newFamily("cpu_frequency_hertz", Gauge, "Current frequency per CPU.")
+		throttles := newFamily("cpu_thermal_throttles_total", Counter, "Thermal throttling events per CPU.")
+		for _, c := range snap.Topology.CPUs {
+			cpu := strconv.Itoa(c.CPU)
+			if c.Frequency != nil {
+				freq.Add(c.Frequency.CurrentMHz*1e6, "cpu", cpu)
+			}
+			if c.Throttle != nil {
+				throttles.Add(float64(c.Throttle.CoreCount), "cpu", cpu, "scope", "core")
+				throttles.Add(float64(c.Throttle.PackageCount), "cpu", cpu, "scope", "package")
+			}
+		}
+		families = append(families, freq, throttles)
+	}
+	if st := snap.Stats; st != nil {
+		counter := func(name, help string, value uint64) *Family {
+			f := newFamily(name, Counter, help)
+			f.Add(float64(value))
+			return f
+		}
+		procs := newFamily("procs", Gauge, "Processes running or blocked on IO.")
+		procs.Add(float64(st.ProcsRunning), "state", "running")
+		procs.Add(float64(st.ProcsBlocked), "state", "blocked")
+
+		softirqs := newFamily("softirqs_total", Counter, "Soft interrupts by type.")
+		types := make([]string, 0, len(st.SoftIRQs))
+		for typ := range st.SoftIRQs {
+			types = append(types, typ)
+		}
+		sort.Strings(types)
+		for _, typ := range types {
+			softirqs.Add(float64(st.SoftIRQs[typ]), "type", typ)
+		}
+
+		families = append(families,
+			counter("context_switches_total", "Context switches since boot.", st.ContextSwitches),
+			counter("interrupts_total", "Interrupts serviced since boot.", st.Interrupts),
+			counter("forks_total", "Processes and threads created since boot.", st.ProcessesCreated),
+			procs, softirqs,
+		)
+	}
+	return families
+}
+
+// MemoryFamilies maps a memory snapshot to memory and swap gauges.
+func MemoryFamilies(snap memoryinfo.Snapshot) []*Family {
+	gauge := func(name, help string, value float64) *Family {
+		f := newFamily(name, Gauge, help)
+		f.Add(value)
+		return f
+	}
+
+	slab := newFamily("memory_slab_bytes", Gauge, "Memory used by the kernel slab allocator in bytes.")
+	slab.Add(float64(snap.SlabReclaimable), "type", "reclaimable")
+	slab.Add(float64(snap.SlabUnreclaimable), "type", "unreclaimable")
+
+	hugepages := newFamily("memory_hugepages", Gauge, "Huge pages by state.")
+	hugepages.Add(float64(snap.HugePagesTotal), "state", "total")
+	hugepages.Add(float64(snap.HugePagesFree), "state", "free")
+	hugepages.Add(float64(snap.HugePagesReserved), "state", "reserved")
+	hugepages.Add(float64(snap.HugePagesSurplus), "state", "surplus")
+
+	families := []*Family{
+		gauge("memory_total_bytes", "Total physical memory in bytes.", float64(snap.TotalMemory)),
+		gauge("memory_available_bytes", "Memory available for new allocations in bytes.", float64(snap.AvailableMemory)),
+		gauge("memory_used_bytes", "Used memory in bytes.", float64(snap.UsedMemory)),
+		gauge("memory_free_bytes", "Free memory in bytes.", float64(snap.FreeMemory)),
+		gauge("memory_used_percent", "Used memory in percent.", snap.UsedMemoryPercent),
+		gauge("swap_total_bytes", "Total swap in bytes.", float64(snap.TotalSwap)),
+		gauge("swap_used_bytes", "Used swap in bytes.", float64(snap.UsedSwap)),
+		gauge("swap_free_bytes", "Free swap in bytes.", float64(snap.FreeSwap)),
+		gauge("swap_used_percent", "Used swap in percent.", snap.UsedSwapPercent),
+		gauge("memory_buffers_bytes", "Memory used by kernel buffers in bytes.", float64(snap.Buffers)),
+		gauge("memory_cached_bytes", "Memory used by the page cache in bytes.", float64(snap.Cached)),
+		gauge("memory_shared_bytes", "Shared memory, mostly tmpfs, in bytes.", float64(snap.Shared)),
+		slab,
+		gauge("memory_dirty_bytes", "Memory waiting to be written back to disk in bytes.", float64(snap.Dirty)),
+		gauge("memory_writeback_bytes", "Memory being written back to disk in bytes.", float64(snap.Writeback)),
+		hugepages,
+		gauge("memory_hugepage_size_bytes", "Size of a huge page in bytes.", float64(snap.HugePageSize)),
+		gauge("memory_committed_bytes", "Memory allocated by all processes in bytes.", float64(snap.CommittedAS)),
+		gauge("memory_commit_limit_bytes", "Memory that can be allocated before overcommit in bytes.", float64(snap.CommitLimit)),
+	}
+	if p := snap.Paging; p != nil {
+		counter := func(name, help string, value uint64) *Family {
+			f := newFamily(name, Counter, help)
+			f.Add(float64(value))
+			return f
+		}
+		families = append(families,
+			counter("swap_in_pages_total", "Pages swapped in since boot.", p.SwapIn),
+			counter("swap_out_pages_total", "Pages swapped out since boot.", p.SwapOut),
+			counter("page_faults_total", "Page faults since boot.", p.PageFaults),
+			counter("major_page_faults_total", "Major page faults since boot.", p.MajorFaults),
+			counter("oom_kills_total", "Processes killed by the OOM killer since boot.", p.OOMKills),
+		)
+	}
+	return families
+}
+
+// DiskFamilies maps a disk snapshot to per-mountpoint usage and per-device
+// IO counters.
+func DiskFamilies(snap diskinfo.Snapshot) []*Family {
+	size := newFamily("filesystem_size_bytes", Gauge, "Filesystem size in bytes.")
+	used := newFamily("filesystem_used_bytes", Gauge, "Used filesystem space in bytes.")
+	free := newFamily("filesystem_free_bytes", Gauge, "Free filesystem space in bytes.")
+	usedPercent := newFamily("filesystem_used_percent", Gauge, "Used filesystem space in percent.")
+	deviceError := newFamily("filesystem_device_error", Gauge, "Whether the usage of a filesystem could not be read.")
+
+	reads := newFamily("disk_reads_completed_total", Counter, "Reads completed per device.")
+	writes := newFamily("disk_writes_completed_total", Counter, "Writes completed per device.")
+	readBytes := newFamily("disk_read_bytes_total", Counter, "Bytes read per device.")
+	writtenBytes := newFamily("disk_written_bytes_total", Counter, "Bytes written per device.")
+
+	seen := make(map[string]bool)
+	for _, p := range snap.Partitions {
+		labels := []string{"device", p.Device, "mountpoint", p.Mountpoint, "fstype", p.Filesystem}
+		if p.Error != "" {
+			deviceError.Add(1, labels...)
+		} else {
+			deviceError.Add(0, labels...)
+			size.Add(float64(p.TotalSpace), labels...)
+			used.Add(float64(p.UsedSpace), labels...)
+			free.Add(float64(p.FreeSpace), labels...)
+			usedPercent.Add(p.UsedPercent, labels...)
+		}
+
+		// The same device can be mounted more than once.
+		if seen[p.Device] {
+			continue
+		}
+		seen[p.Device] = true
+		reads.Add(float64(p.IOReadCount), "device", p.Device)
+		writes.Add(float64(p.IOWriteCount), "device", p.Device)
+		readBytes.Add(float64(p.IOReadBytes), "device", p.Device)
+		writtenBytes.Add(float64(p.IOWriteBytes), "device", p.Device)
+	}
+
+	return []*Family{size, used, free, usedPercent, deviceError, reads, writes, readBytes, writtenBytes}
+}
+
+// DiskIOFamilies maps a disk IO snapshot to per-device rates over the
+// collection window.
+func DiskIOFamilies(snap diskinfo.IOSnapshot) []*Family {
+	ops := newFamily("disk_io_operations_per_second", Gauge, "Completed operations per second per device.")
+	throughput := newFamily("disk_io_bytes_per_second", Gauge, "Bytes transferred per second per device.")
+	await := newFamily("disk_io_await_seconds", Gauge, "Average time an operation took including queueing per device.")
+	queue := newFamily("disk_io_queue_depth", Gauge, "Average number of operations in flight per device.")
+	inFlight := newFamily("disk_io_in_flight", Gauge, "Operations in flight per device.")
+	util := newFamily("disk_io_utilization_ratio", Gauge, "Share of time a device was busy.")
+
+	for _, d := range snap.Devices {
+		ops.Add(d.ReadIOPS, "device", d.Device, "op", "read")
+		ops.Add(d.WriteIOPS, "device", d.Device, "op", "write")
+		throughput.Add(d.ReadBytesPerSecond, "device", d.Device, "op", "read")
+		throughput.Add(d.WriteBytesPerSecond, "device", d.Device, "op", "write")
+		await.Add(d.ReadAwaitMs/1000, "device", d.Device, "op", "read")
+		await.Add(d.WriteAwaitMs/1000, "device", d.Device, "op", "write")
+		queue.Add(d.QueueDepth, "device", d.Device)
+		inFlight.Add(float64(d.InFlight), "device", d.Device)
+		util.Add(d.UtilPercent/100, "device", d.Device)
+	}
+	return []*Family{ops, throughput, await, queue, inFlight, util}
+}
+
+// NetworkFamilies maps a network snapshot to per-interface IO counters and
+// conntrack statistics summed over all CPUs.
+func NetworkFamilies(snap networkinfo.Snapshot) []*Family {
+	recvBytes := newFamily("network_receive_bytes_total", Counter, "Bytes received per interface.")
+	sentBytes := newFamily("network_transmit_bytes_total", Counter, "Bytes transmitted per interface.")
+	recvPackets := newFamily("network_receive_packets_total", Counter, "Packets received per interface.")
+	sentPackets := newFamily("network_transmit_packets_total", Counter, "Packets transmitted per interface.")
+	recvErrs := newFamily("network_receive_errs_total", Counter, "Receive errors per interface.")
+	sentErrs := newFamily("network_transmit_errs_total", Counter, "Transmit errors per interface.")
+	recvDrops := newFamily("network_receive_drop_total", Counter, "Received packets dropped per interface.")
+	sentDrops := newFamily("network_transmit_drop_total", Counter, "Transmitted packets dropped per interface.")
+
+	for _, nic := range snap.NicIOCounters {
+		recvBytes.Add(float64(nic.BytesRecv), "interface", nic.Name)
+		sentBytes.Add(float64(nic.BytesSent), "interface", nic.Name)
+		recvPackets.Add(float64(nic.PacketsRecv), "interface", nic.Name)
+		sentPackets.Add(float64(nic.PacketsSent), "interface", nic.Name)
+		recvErrs.Add(float64(nic.Errin), "interface", nic.Name)
+		sentErrs.Add(float64(nic.Errout), "interface", nic.Name)
+		recvDrops.Add(float64(nic.Dropin), "interface", nic.Name)
+		sentDrops.Add(float64(nic.Dropout), "interface", nic.Name)
+	}
+
+	families := []*Family{recvBytes, sentBytes, recvPackets, sentPackets, recvErrs, sentErrs, recvDrops, sentDrops}
+	if len(snap.ConntrackStats) == 0 {
+		return families
+	}
+
+	entries := newFamily("conntrack_entries", Gauge, "Number of entries in the conntrack table.")
+	entries.Add(float64(snap.ConntrackStats[0].Entries))
+
+	var found, invalid, insert, insertFailed, drop, earlyDrop, searchRestart float64
+	for _, stat := range snap.ConntrackStats {
+		found += float64(stat.Found)
+		invalid += float64(stat.Invalid)
+		insert += float64(stat.Insert)
+		insertFailed += float64(stat.InsertFailed)
+		drop += float64(stat.Drop)
+		earlyDrop += float64(stat.EarlyDrop)
+		searchRestart += float64(stat.SearchRestart)
+	}
+
+	counter := func(name, help string, value float64) *Family {
+		f := newFamily(name, Counter, help)
+		f.Add(value)
+		return f
+	}
+
+	return append(families, entries,
+		counter("conntrack_found_total", "Successful conntrack table lookups.", found),
+		counter("conntrack_invalid_total", "Packets that could not be tracked.", invalid),
+		counter("conntrack_insert_total", "Entries inserted into the conntrack table.", insert),
+		counter("conntrack_insert_failed_total", "Conntrack insertions that failed.", insertFailed),
+		counter("conntrack_drop_total", "Packets dropped due to conntrack failure.", drop),
+		counter("conntrack_early_drop_total", "Entries dropped to make room for new ones.", earlyDrop),
+		counter("conntrack_search_restart_total", "Conntrack lookups restarted due to table resizes.", searchRestart),
+	)
+}
+
+// SensorFamilies maps a sensor snapshot to temperature gauges.
+func SensorFamilies(snap sensorinfo.Snapshot) []*Family {
+	temp := newFamily("sensor_temperature_celsius", Gauge, "Sensor temperature in degrees Celsius.")
+	for _, t := range snap.SensorTemperatures {
+		temp.Add(t.Temperature, "sensor", t.SensorKey)
+	}
+	return []*Family{temp}
+}
+
+// GPUFamilies maps the most recent GPU sample to memory gauges.
+func GPUFamilies(snap gpuinfo.Snapshot) []*Family {
+	total := newFamily("gpu_memory_total_bytes", Gauge, "Total GPU memory in bytes.")
+	used := newFamily("gpu_memory_used_bytes", Gauge, "Used GPU memory in bytes.")
+	free := newFamily("gpu_memory_free_bytes", Gauge, "Free GPU memory in bytes.")
+
+	if n := len(snap.Samples); n > 0 {
+		mem := snap.Samples[n-1].NvidiaMemory
+		total.Add(float64(mem.Total*mebibyte), "vendor", "nvidia")
+		used.Add(float64(mem.Used*mebibyte), "vendor", "nvidia")
+		free.Add(float64(mem.Free*mebibyte), "vendor", "nvidia")
+	}
+	return []*Family{total, used, free}
+}
+
+// CgroupFamilies maps a cgroup snapshot to per-cgroup CPU, memory, IO and
+// task metrics.
+func CgroupFamilies(snap cgroupinfo.Snapshot) []*Family {
+	cpuSeconds := newFamily("cgroup_cpu_usage_seconds_total", Counter, "CPU time used per cgroup.")
+	throttledPeriods := newFamily("cgroup_cpu_throttled_periods_total", Counter, "Enforcement periods in which a cgroup was throttled.")
+	throttledSeconds := newFamily("cgroup_cpu_throttled_seconds_total", Counter, "Time a cgroup was throttled for.")
+	cpuLimit := newFamily("cgroup_cpu_limit_cores", Gauge, "CPU quota of a cgroup in cores.")
+	memUsage := newFamily("cgroup_memory_usage_bytes", Gauge, "Memory charged to a cgroup in bytes.")
+	memLimit := newFamily("cgroup_memory_limit_bytes", Gauge, "Memory limit of a cgroup in bytes.")
+	memEvents := newFamily("cgroup_memory_events_total", Counter, "Memory limit events per cgroup.")
+	ioRead := newFamily("cgroup_io_read_bytes_total", Counter, "Bytes read per cgroup and device.")
+	ioWritten := newFamily("cgroup_io_written_bytes_total", Counter, "Bytes written per cgroup and device.")
+	pids := newFamily("cgroup_pids", Gauge, "Number of tasks in a cgroup.")
+	stalled := newFamily("cgroup_pressure_stalled_seconds_total", Counter, "Time tasks in a cgroup were stalled per resource.")
+
+	for _, cg := range snap.Cgroups {
+		if cg.CPU != nil {
+			cpuSeconds.Add(float64(cg.CPU.UsageUsec)/1e6, "cgroup", cg.Path)
+			throttledPeriods.Add(float64(cg.CPU.NrThrottled), "cgroup", cg.Path)
+			throttledSeconds.Add(float64(cg.CPU.ThrottledUsec)/1e6, "cgroup", cg.Path)
+			if cg.CPU.LimitCores > 0 {
+				cpuLimit.Add(cg.CPU.LimitCores, "cgroup", cg.Path)
+			}
+		}
+		if cg.Memory != nil {
+			memUsage.Add(float64(cg.Memory.Current), "cgroup", cg.Path)
+			if cg.Memory.Max != nil {
+				memLimit.Add(float64(*cg.Memory.Max), "cgroup", cg.Path)
+			}
+			events := make([]string, 0, len(cg.Memory.Events))
+			for event := range cg.Memory.Events {
+				events = append(events, event)
+			}
+			sort.Strings(events)
+			for _, event := range events {
+				memEvents.Add(float64(cg.Memory.Events[event]), "cgroup", cg.Path, "event", event)
+			}
+		}
+		for _, io := range cg.IO {
+			ioRead.Add(float64(io.ReadBytes), "cgroup", cg.Path, "device", io.Device)
+			ioWritten.Add(float64(io.WriteBytes), "cgroup", cg.Path, "device", io.Device)
+		}
+		if cg.Pids != nil {
+			pids.Add(float64(cg.Pids.Current), "cgroup", cg.Path)
+		}
+		if cg.Pressure != nil {
+			addStalled(stalled, *cg.Pressure, "cgroup", cg.Path)
+		}
+	}
+	return []*Family{cpuSeconds, throttledPeriods, throttledSeconds, cpuLimit, memUsage, memLimit, memEvents, ioRead, ioWritten, pids, stalled}
+}
+
+// PressureFamilies maps a pressure snapshot to stall time counters and the
+// kernel's running averages as ratios.
+func PressureFamilies(snap pressureinfo.Snapshot) []*Family {
+	stalled := newFamily("pressure_stalled_seconds_total", Counter, "Time tasks were stalled per resource.")
+	ratio := newFamily("pressure_stalled_ratio", Gauge, "Share of time tasks were stalled per resource, averaged over a window.")
+
+	addStalled(stalled, snap)
+	for _, name := range pressureinfo.ResourceNames {
+		r := snap.Resource(name)
+		if r == nil {
+			continue
+		}
+		for _, kind := range []struct {
+			name string
+			avg  *pressureinfo.Averages
+		}{{"some", r.Some}, {"full", r.Full}} {
+			if kind.avg == nil {
+				continue
+			}
+			ratio.Add(kind.avg.Avg10/100, "resource", name, "kind", kind.name, "window", "10s")
+			ratio.Add(kind.avg.Avg60/100, "resource", name, "kind", kind.name, "window", "60s")
+			ratio.Add(kind.avg.Avg300/100, "resource", name, "kind", kind.name, "window", "300s")
+		}
+	}
+	return []*Family{stalled, ratio}
+}
+
+// addStalled adds the total stall time of every resource in snap to f.
+func addStalled(f *Family, snap pressureinfo.Snapshot, labels ...string) {
+	for _, name := range pressureinfo.ResourceNames {
+		r := snap.Resource(name)
+		if r == nil {
+			continue
+		}
+		if r.Some != nil {
+			f.Add(float64(r.Some.Total)/1e6, append([]string{"resource", name, "kind", "some"}, labels...)...)
+		}
+		if r.Full != nil {
+			f.Add(float64(r.Full.Total)/1e6, append([]string{"resource", name, "kind", "full"}, labels...)...)
+		}
+	}
+}
+
+// Families maps any known snapshot type to its metric families.
+func Families(data interface{}) []*Family {
+	switch snap := data.(type) {
+	case cpuinfo.Snapshot:
+		return CPUFamilies(snap)
+	case memoryinfo.Snapshot:
+		return MemoryFamilies(snap)
+	case diskinfo.Snapshot:
+		return DiskFamilies(snap)
+	case diskinfo.IOSnapshot:
+		return DiskIOFamilies(snap)
+	case networkinfo.Snapshot:
+		return NetworkFamilies(snap)
+	case sensorinfo.Snapshot:
+		return SensorFamilies(snap)
+	case gpuinfo.Snapshot:
+		return GPUFamilies(snap)
+	case cgroupinfo.Snapshot:
+		return CgroupFamilies(snap)
+	case pressureinfo.Snapshot:
+		return PressureFamilies(snap)
+	}
+	return nil
+}
+
+// Gather collects the families of every cached snapshot, plus the health of
+// each collector.
+func Gather(s *sampler.Sampler) []*Family {
+	up := newFamily("collector_up", Gauge, "Whether the last sample of a collector succeeded.")
+	timestamp := newFamily("collector_last_sample_timestamp_seconds", Gauge, "Unix time of the last sample of a collector.")
+	duration := newFamily("collector_sample_duration_seconds", Gauge, "Time the last sample of a collector took.")
+
+	families := []*Family{up, timestamp, duration}
+	for _, name := range s.Names() {
+		sample, ok := s.Latest(name)
+		if !ok {
+			continue
+		}
+
+		value := 1.0
+		if sample.Err != nil {
+			value = 0
+		}
+		up.Add(value, "collector", name)
+		timestamp.Add(float64(sample.Timestamp.UnixNano())/1e9, "collector", name)
+		duration.Add(sample.Duration.Seconds(), "collector", name)
+
+		if sample.Err == nil {
+			families = append(families, Families(sample.Data)...)
+		}
+	}
+	return families
+}
+
+// Handler serves the cached snapshots in the Prometheus text format.
+func Handler(s *sampler.Sampler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Content-Type", ContentType)
+		c.Status(http.StatusOK)
+		if err := Write(c.Writer, Gather(s)); err != nil {
+			c.Error(err)
+		}
+	}
+}
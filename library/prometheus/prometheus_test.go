@@ -0,0 +1,97 @@
+package prometheus
+
+import (
+	"bytes"
+	"flag"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	diskinfo "checker/library/disk"
+	pressureinfo "checker/library/pressure"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// checkGolden compares the exposition of families with testdata/name.
+func checkGolden(t *testing.T, name string, families []*Family) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := Write(&buf, families); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != string(want) {
+		t.Errorf("output differs from %s:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	escaped := newFamily("escaped", Gauge, "Help with a backslash \\ and a\nnewline.")
+	escaped.Add(1, "path", `C:\dir`, "quote", `say "hi"`, "multi", "a\nb")
+	escaped.Add(2)
+
+	special := newFamily("special_values", Gauge, "Values that are not finite.")
+	special.Add(math.NaN(), "value", "nan")
+	special.Add(math.Inf(1), "value", "+inf")
+	special.Add(math.Inf(-1), "value", "-inf")
+	special.Add(-0.5, "value", "negative")
+	special.Add(1e21, "value", "large")
+
+	empty := newFamily("empty", Gauge, "A family without samples.")
+
+	counter := newFamily("events_total", Counter, "A counter.")
+	counter.Add(42)
+
+	checkGolden(t, "write.golden", []*Family{escaped, empty, special, counter})
+}
+
+func TestDiskFamilies(t *testing.T) {
+	snap := diskinfo.Snapshot{Partitions: []diskinfo.Partition{
+		{
+			Device: "/dev/sda1", Mountpoint: "/", Filesystem: "ext4",
+			TotalSpace: 100 << 30, UsedSpace: 25 << 30, FreeSpace: 75 << 30, UsedPercent: 25,
+			IOReadCount: 10, IOWriteCount: 20, IOReadBytes: 4096, IOWriteBytes: 8192,
+		},
+		// A second mount of the same device only adds filesystem samples.
+		{
+			Device: "/dev/sda1", Mountpoint: "/srv", Filesystem: "ext4",
+			TotalSpace: 100 << 30, UsedSpace: 25 << 30, FreeSpace: 75 << 30, UsedPercent: 25,
+			IOReadCount: 10, IOWriteCount: 20, IOReadBytes: 4096, IOWriteBytes: 8192,
+		},
+		{Device: "server:/export", Mountpoint: "/mnt/nfs", Filesystem: "nfs4", Error: "permission denied"},
+	}}
+	checkGolden(t, "disk.golden", DiskFamilies(snap))
+}
+
+func TestDiskIOFamilies(t *testing.T) {
+	snap := diskinfo.IOSnapshot{Window: 2, Devices: []diskinfo.DeviceIO{{
+		Device: "nvme0n1", ReadIOPS: 100, WriteIOPS: 50,
+		ReadBytesPerSecond: 409600, WriteBytesPerSecond: 204800,
+		ReadAwaitMs: 0.5, WriteAwaitMs: 2, AwaitMs: 1,
+		QueueDepth: 0.25, InFlight: 1, UtilPercent: 12.5,
+	}}}
+	checkGolden(t, "diskio.golden", DiskIOFamilies(snap))
+}
+
+func TestPressureFamilies(t *testing.T) {
+	snap := pressureinfo.Snapshot{
+		CPU: &pressureinfo.Resource{Some: &pressureinfo.Averages{Avg10: 1.5, Avg60: 0.5, Avg300: 0.25, Total: 2500000}},
+		Memory: &pressureinfo.Resource{
+			Some: &pressureinfo.Averages{Avg10: 10, Avg60: 5, Avg300: 1, Total: 1000000},
+			Full: &pressureinfo.Averages{Avg10: 2, Avg60: 1, Avg300: 0.5, Total: 500000},
+		},
+	}
+	checkGolden(t, "pressure.golden", PressureFamilies(snap))
+}
@@ -0,0 +1,263 @@
+package sampler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrUnknownCollector is returned for collectors that were never
+// registered, e.g. because they are disabled.
+var ErrUnknownCollector = errors.New("unknown or disabled collector")
+
+// CollectFunc produces one snapshot of a collector.
+type CollectFunc func(ctx context.Context) (interface{}, error)
+
+// Sample is the latest output of a collector together with when it was
+// taken and how long it took.
+type Sample struct {
+	Data      interface{}
+	Err       error
+	Timestamp time.Time
+	Duration  time.Duration
+}
+
+// Listener is called with every new sample, from the goroutine sampling
+// that collector. It must not block.
+type Listener func(name string, sample Sample)
+
+type job struct {
+	name    string
+	period  time.Duration
+	timeout time.Duration
+	collect CollectFunc
+	ready   chan struct{}
+}
+
+// Sampler runs every registered collector on its own period in the
+// background and keeps the latest sample of each in memory, so readers
+// never trigger a collection themselves.
+type Sampler struct {
+	mu        sync.RWMutex
+	jobs      map[string]*job
+	samples   map[string]Sample
+	listeners []Listener
+}
+
+func New() *Sampler {
+	return &Sampler{
+		jobs:    make(map[string]*job),
+		samples: make(map[string]Sample),
+	}
+}
+
+// Register adds a collector sampled every period. A zero timeout defaults
+// to the period. Register must be called before Run.
+func (s *Sampler) Register(name string, period, timeout time.Duration, collect CollectFunc) {
+	if timeout <= 0 {
+		timeout = period
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[name] = &job{
+		name:    name,
+		period:  period,
+		timeout: timeout,
+		collect: collect,
+		ready:   make(chan struct{}),
+	}
+}
+
+// OnSample registers a listener notified of every new sample.
+func (s *Sampler) OnSample(fn Listener) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listeners = append(s.listeners, fn)
+}
+
+// Run samples every registered collector until ctx is cancelled.
+func (s *Sampler) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	s.mu.RLock()
+	for _, j := range s.jobs {
+		wg.Add(1)
+		go func(j *job) {
+			defer wg.Done()
+			s.loop(ctx, j)
+		}(j)
+	}
+	s.mu.RUnlock()
+
+	wg.Wait()
+}
+
+func (s *Sampler) loop(ctx context.Context, j *job) {
+	ticker := time.NewTicker(j.period)
+	defer ticker.Stop()
+
+	first := true
+	for {
+		s.sample(ctx, j)
+		if first {
+			close(j.ready)
+			first = false
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Sampler) sample(ctx context.Context, j *job) {
+	ctx, cancel := context.WithTimeout(ctx, j.timeout)
+	defer cancel()
+
+	start := time.Now()
+	data, err := j.collect(ctx)
+	if err != nil {
+		log.Printf("Error sampling %s: %v", j.name, err)
+	}
+
+	sample := Sample{
+		Data:      data,
+		Err:       err,
+		Timestamp: start,
+		Duration:  time.Since(start),
+	}
+
+	s.mu.Lock()
+	s.samples[j.name] = sample
+	listeners := s.listeners
+	s.mu.Unlock()
+
+	for _, fn := range listeners {
+		fn(j.name, sample)
+	}
+}
+
+// Names returns the names of all registered collectors, sorted.
+func (s *Sampler) Names() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	names := make([]string, 0, len(s.jobs))
+	for name := range s.jobs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Latest returns the most recent sample of name, if any has been taken.
+func (s *Sampler) Latest(name string) (Sample, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sample, ok := s.samples[name]
+	return sample, ok
+}
+
+// Wait blocks until the first sample of name is available and returns it.
+func (s *Sampler) Wait(ctx context.Context, name string) (Sample, error) {
+	s.mu.RLock()
+	j, ok := s.jobs[name]
+	s.mu.RUnlock()
+	if !ok {
+		return Sample{}, fmt.Errorf("%w: %s", ErrUnknownCollector, name)
+	}
+
+	select {
+	case <-j.ready:
+	case <-ctx.Done():
+		return Sample{}, ctx.Err()
+	}
+
+	sample, _ := s.Latest(name)
+	return sample, nil
+}
+
+// Get returns the latest snapshot of name as T, waiting for the first
+// sample if needed.
+func Get[T any](ctx context.Context, s *Sampler, name string) (T, time.Time, error) {
+	var zero T
+
+	sample, err := s.Wait(ctx, name)
+	if err != nil {
+		return zero, time.Time{}, err
+	}
+	if sample.Err != nil {
+		return zero, sample.Timestamp, sample.Err
+	}
+
+	data, ok := sample.Data.(T)
+	if !ok {
+		return zero, sample.Timestamp, fmt.Errorf("collector %q holds %T, not %T", name, sample.Data, zero)
+	}
+	return data, sample.Timestamp, nil
+}
+
+// Cached returns a collect function reading name from the cache, applying
+// view to the snapshot. It can be used wherever a live collector is
+// expected, e.g. for websocket streams.
+func (s *Sampler) Cached(name string, view func(interface{}) interface{}) func(ctx context.Context) (interface{}, error) {
+	return func(ctx context.Context) (interface{}, error) {
+		sample, err := s.Wait(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if sample.Err != nil {
+			return nil, sample.Err
+		}
+		if view == nil {
+			return sample.Data, nil
+		}
+		return view(sample.Data), nil
+	}
+}
+
+// Handler serves the cached snapshot of name as JSON. The time the sample
+// was taken is returned in the X-Sampled-At header.
+func (s *Sampler) Handler(name string, view func(interface{}) interface{}) gin.HandlerFunc {
+	return s.Serve(name, func(c *gin.Context, data interface{}) {
+		if view != nil {
+			data = view(data)
+		}
+		c.JSON(http.StatusOK, data)
+	})
+}
+
+// Serve is like Handler but leaves writing the response to serve, for
+// endpoints whose output depends on the request, e.g. query parameters.
+func (s *Sampler) Serve(name string, serve func(c *gin.Context, data interface{})) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sample, err := s.Wait(c.Request.Context(), name)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, ErrUnknownCollector) {
+				status = http.StatusNotFound
+			} else if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+				status = http.StatusServiceUnavailable
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Header("X-Sampled-At", sample.Timestamp.UTC().Format(time.RFC3339Nano))
+		if sample.Err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": sample.Err.Error()})
+			return
+		}
+		serve(c, sample.Data)
+	}
+}
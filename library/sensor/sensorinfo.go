@@ -1,6 +1,8 @@
 package sensorinfo
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"sync"
 	"time"
@@ -9,22 +11,29 @@ import (
 	"github.com/shirou/gopsutil/host"
 )
 
-type SensorData struct {
+// DefaultTimeout bounds a collection started from GetSensorInfo.
+const DefaultTimeout = 3 * time.Second
+
+var ErrTimeout = errors.New("request timed out")
+
+// Snapshot is a point-in-time reading of the temperature sensors.
+type Snapshot struct {
 	SensorTemperatures []host.TemperatureStat `json:"sensor_temperatures"`
 	TemperatureStat    []host.TemperatureStat `json:"temperature_stat"`
 }
 
-func GetSensorInfo(c *gin.Context) {
+// Collect reads the temperature sensors, returning ErrTimeout if ctx is
+// done first.
+func Collect(ctx context.Context) (Snapshot, error) {
 	resultChan := make(chan interface{}, 2)
 	var wg sync.WaitGroup
-	timeout := time.After(3 * time.Second)
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		temps, err := host.SensorsTemperatures()
+		temps, err := host.SensorsTemperaturesWithContext(ctx)
 		if err != nil {
-			resultChan <- map[string]string{"error": "failed to get sensor temperatures"}
+			resultChan <- errors.New("failed to get sensor temperatures")
 			return
 		}
 		resultChan <- temps
@@ -33,9 +42,9 @@ func GetSensorInfo(c *gin.Context) {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		tempStat, err := host.SensorsTemperatures()
+		tempStat, err := host.SensorsTemperaturesWithContext(ctx)
 		if err != nil {
-			resultChan <- map[string]string{"error": "failed to get temperature stat"}
+			resultChan <- errors.New("failed to get temperature stat")
 			return
 		}
 		resultChan <- tempStat
@@ -46,30 +55,42 @@ func GetSensorInfo(c *gin.Context) {
 		close(resultChan)
 	}()
 
-	sensorData := SensorData{}
+	snap := Snapshot{}
 	for {
 		select {
 		case res, ok := <-resultChan:
 			if !ok {
-				goto RESULT
+				return snap, nil
 			}
 			switch v := res.(type) {
 			case []host.TemperatureStat:
-				if len(sensorData.SensorTemperatures) == 0 {
-					sensorData.SensorTemperatures = v
+				if len(snap.SensorTemperatures) == 0 {
+					snap.SensorTemperatures = v
 				} else {
-					sensorData.TemperatureStat = v
+					snap.TemperatureStat = v
 				}
-			case map[string]string:
-				c.JSON(http.StatusInternalServerError, v)
-				return
+			case error:
+				return Snapshot{}, v
 			}
-		case <-timeout:
-			c.JSON(http.StatusGatewayTimeout, gin.H{"error": "request timed out"})
-			return
+		case <-ctx.Done():
+			return Snapshot{}, ErrTimeout
 		}
 	}
+}
+
+func GetSensorInfo(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), DefaultTimeout)
+	defer cancel()
+
+	snap, err := Collect(ctx)
+	if errors.Is(err, ErrTimeout) {
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
-RESULT:
-	c.JSON(http.StatusOK, sensorData)
+	c.JSON(http.StatusOK, snap)
 }
@@ -0,0 +1,116 @@
+package stream
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// subscriberBuffer is how many events a slow subscriber may lag behind
+// before events are dropped for it.
+const subscriberBuffer = 64
+
+// Hub fans out published events to every current subscriber. Publishing
+// never blocks; events are dropped for subscribers that fall behind.
+type Hub struct {
+	mu   sync.Mutex
+	subs map[chan interface{}]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{subs: make(map[chan interface{}]struct{})}
+}
+
+// Publish sends event to every subscriber.
+func (h *Hub) Publish(event interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subs {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel receiving published events and a function
+// to unsubscribe.
+func (h *Hub) Subscribe() (<-chan interface{}, func()) {
+	ch := make(chan interface{}, subscriberBuffer)
+
+	h.mu.Lock()
+	h.subs[ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subs, ch)
+			h.mu.Unlock()
+		})
+	}
+}
+
+// EventHandler returns a gin handler pushing every event from hub to the
+// client as it happens. If initial is not nil its result is sent first,
+// e.g. the current state the events apply to.
+func (s *Streamer) EventHandler(name string, hub *Hub, initial func() interface{}) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		conn, err := s.upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			log.Printf("Failed to set websocket upgrade for %s events: %v", name, err)
+			return
+		}
+		defer conn.Close()
+
+		events, unsubscribe := hub.Subscribe()
+		defer unsubscribe()
+
+		done := make(chan struct{})
+		go readLoop(conn, done, func([]byte) {})
+
+		pingTicker := time.NewTicker(pingPeriod)
+		defer pingTicker.Stop()
+
+		send := func(v interface{}) bool {
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteJSON(v); err != nil {
+				log.Printf("Failed to send %s events over websocket: %v", name, err)
+				return false
+			}
+			return true
+		}
+
+		if initial != nil && !send(initial()) {
+			return
+		}
+
+		ctx := c.Request.Context()
+		for {
+			select {
+			case <-done:
+				conn.SetWriteDeadline(time.Now().Add(writeWait))
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+				return
+			case <-ctx.Done():
+				conn.SetWriteDeadline(time.Now().Add(writeWait))
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""))
+				return
+			case event := <-events:
+				if !send(event) {
+					return
+				}
+			case <-pingTicker.C:
+				conn.SetWriteDeadline(time.Now().Add(writeWait))
+				if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
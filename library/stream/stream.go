@@ -0,0 +1,224 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// Time allowed to write a message to the peer.
+	writeWait = 10 * time.Second
+	// Time allowed to read the next pong message from the peer.
+	pongWait = 60 * time.Second
+	// Send pings to peer with this period. Must be less than pongWait.
+	pingPeriod = (pongWait * 9) / 10
+	// Maximum size of a subscribe message sent by the peer.
+	maxMessageSize = 1024
+
+	DefaultInterval = 1 * time.Second
+	MinInterval     = 250 * time.Millisecond
+	MaxInterval     = 1 * time.Hour
+)
+
+// CollectFunc produces one snapshot to be pushed to a websocket client.
+type CollectFunc func(ctx context.Context) (interface{}, error)
+
+// Streamer upgrades requests to websocket connections and pushes snapshots
+// to each client at the interval the client asked for.
+type Streamer struct {
+	upgrader websocket.Upgrader
+}
+
+// subscribeMessage is the message a client may send at any time to change
+// its sampling interval, e.g. {"interval": "5s"} or {"interval": 5000}.
+type subscribeMessage struct {
+	Interval json.RawMessage `json:"interval"`
+}
+
+func New(checkOrigin func(r *http.Request) bool) *Streamer {
+	return &Streamer{
+		upgrader: websocket.Upgrader{
+			CheckOrigin: checkOrigin,
+		},
+	}
+}
+
+// ParseInterval accepts either a Go duration string ("2s", "500ms") or a
+// plain number of milliseconds.
+func ParseInterval(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return DefaultInterval, nil
+	}
+
+	var interval time.Duration
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+		interval = time.Duration(ms) * time.Millisecond
+	} else if d, err := time.ParseDuration(s); err == nil {
+		interval = d
+	} else {
+		return 0, fmt.Errorf("invalid interval %q", s)
+	}
+
+	if interval < MinInterval || interval > MaxInterval {
+		return 0, fmt.Errorf("interval %s out of range [%s, %s]", interval, MinInterval, MaxInterval)
+	}
+	return interval, nil
+}
+
+func parseSubscribe(message []byte) (time.Duration, error) {
+	var msg subscribeMessage
+	if err := json.Unmarshal(message, &msg); err != nil {
+		return 0, fmt.Errorf("invalid subscribe message: %v", err)
+	}
+	if len(msg.Interval) == 0 {
+		return 0, errors.New("subscribe message has no interval")
+	}
+
+	var s string
+	if err := json.Unmarshal(msg.Interval, &s); err != nil {
+		s = string(msg.Interval)
+	}
+	return ParseInterval(s)
+}
+
+// Handler returns a gin handler streaming the output of collect over a
+// websocket. The initial interval is taken from the "interval" query
+// parameter and can be changed later with a subscribe message.
+func (s *Streamer) Handler(name string, collect CollectFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		interval, err := ParseInterval(c.Query("interval"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		conn, err := s.upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			log.Printf("Failed to set websocket upgrade for %s info: %v", name, err)
+			return
+		}
+		defer conn.Close()
+
+		intervalCh := make(chan time.Duration, 1)
+		errCh := make(chan error, 1)
+		done := make(chan struct{})
+		go readLoop(conn, done, func(message []byte) {
+			interval, err := parseSubscribe(message)
+			if err != nil {
+				select {
+				case errCh <- err:
+				default:
+				}
+				return
+			}
+
+			// Only the latest requested interval matters.
+			select {
+			case <-intervalCh:
+			default:
+			}
+			intervalCh <- interval
+		})
+
+		s.writeLoop(c.Request.Context(), conn, name, collect, interval, intervalCh, errCh, done)
+	}
+}
+
+// readLoop handles pongs and passes client messages to onMessage. It
+// closes done once the client goes away.
+func readLoop(conn *websocket.Conn, done chan<- struct{}, onMessage func(message []byte)) {
+	defer close(done)
+
+	conn.SetReadLimit(maxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Printf("Websocket read error: %v", err)
+			}
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(pongWait))
+		onMessage(message)
+	}
+}
+
+func (s *Streamer) writeLoop(ctx context.Context, conn *websocket.Conn, name string, collect CollectFunc,
+	interval time.Duration, intervalCh <-chan time.Duration, errCh <-chan error, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	pingTicker := time.NewTicker(pingPeriod)
+	defer pingTicker.Stop()
+
+	send := func() bool {
+		collectCtx, cancel := context.WithTimeout(ctx, interval+writeWait)
+		defer cancel()
+
+		var payload interface{}
+		data, err := collect(collectCtx)
+		if err != nil {
+			payload = gin.H{"error": err.Error()}
+		} else {
+			payload = data
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(writeWait))
+		if err := conn.WriteJSON(payload); err != nil {
+			log.Printf("Failed to send %s info over websocket: %v", name, err)
+			return false
+		}
+		return true
+	}
+
+	if !send() {
+		return
+	}
+
+	for {
+		select {
+		case <-done:
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			return
+		case <-ctx.Done():
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""))
+			return
+		case interval = <-intervalCh:
+			ticker.Reset(interval)
+			if !send() {
+				return
+			}
+		case err := <-errCh:
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteJSON(gin.H{"error": err.Error()}); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if !send() {
+				return
+			}
+		case <-pingTicker.C:
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package watch
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	processinfo "checker/library/process"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Spec selects the processes of a watch. Every criterion given must
+// match.
+type Spec struct {
+	Name string
+	// Exe is the exact executable path.
+	Exe string
+	// Cmdline is a regular expression matched against the command line.
+	Cmdline string
+	// Pidfile holds the pid of the watched process, re-read on every
+	// collection.
+	Pidfile string
+	// MinInstances is how many instances must run for the watch to count
+	// as running; 1 if zero.
+	MinInstances int
+}
+
+// Status is the state of one watch as of the last collection. CPUPercent
+// and RSS are summed over all instances.
+type Status struct {
+	Name         string     `json:"name"`
+	Running      bool       `json:"running"`
+	Instances    int        `json:"instances"`
+	MinInstances int        `json:"min_instances"`
+	Pids         []int32    `json:"pids"`
+	Restarts     int        `json:"restarts"`
+	CPUPercent   float64    `json:"cpu_percent"`
+	RSS          uint64     `json:"rss"`
+	LastSeen     *time.Time `json:"last_seen,omitempty"`
+	Error        string     `json:"error,omitempty"`
+}
+
+// Snapshot is the status of every watch.
+type Snapshot struct {
+	Time    time.Time `json:"time"`
+	Watches []Status  `json:"watches"`
+}
+
+type instanceKey struct {
+	pid        int32
+	createTime int64
+}
+
+type watch struct {
+	spec    Spec
+	cmdline *regexp.Regexp
+
+	instances map[instanceKey]bool
+	primed    bool
+	// exited counts instance exits not yet paired with a new instance.
+	exited int
+	status Status
+}
+
+// Watcher tracks the watches across process collections.
+type Watcher struct {
+	mu      sync.RWMutex
+	watches []*watch
+	time    time.Time
+}
+
+func New(specs []Spec) (*Watcher, error) {
+	w := &Watcher{}
+	names := make(map[string]bool)
+	var errs []error
+	for _, spec := range specs {
+		if spec.Name == "" {
+			errs = append(errs, errors.New("watch without a name"))
+			continue
+		}
+		if names[spec.Name] {
+			errs = append(errs, fmt.Errorf("watch %s: duplicate name", spec.Name))
+			continue
+		}
+		names[spec.Name] = true
+
+		if spec.Exe == "" && spec.Cmdline == "" && spec.Pidfile == "" {
+			errs = append(errs, fmt.Errorf("watch %s: needs exe, cmdline or pidfile", spec.Name))
+			continue
+		}
+		if spec.MinInstances <= 0 {
+			spec.MinInstances = 1
+		}
+
+		wt := &watch{spec: spec, instances: make(map[instanceKey]bool)}
+		if spec.Cmdline != "" {
+			re, err := regexp.Compile(spec.Cmdline)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("watch %s: cmdline: %v", spec.Name, err))
+				continue
+			}
+			wt.cmdline = re
+		}
+		wt.status = Status{Name: spec.Name, MinInstances: spec.MinInstances, Pids: []int32{}}
+		w.watches = append(w.watches, wt)
+	}
+	return w, errors.Join(errs...)
+}
+
+// readPidfile returns the pid in path.
+func readPidfile(path string) (int32, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("pidfile %s: invalid pid", path)
+	}
+	return int32(pid), nil
+}
+
+// Observe updates every watch from a process collection taken at t and
+// returns the new statuses.
+func (w *Watcher) Observe(t time.Time, snap processinfo.Snapshot) Snapshot {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.time = t
+	for _, wt := range w.watches {
+		wt.observe(t, snap.Processes)
+	}
+	return w.snapshot()
+}
+
+func (wt *watch) observe(t time.Time, procs []processinfo.Process) {
+	st := &wt.status
+	st.Error = ""
+
+	pidfilePid := int32(-1)
+	if wt.spec.Pidfile != "" {
+		pid, err := readPidfile(wt.spec.Pidfile)
+		if err != nil {
+			// A missing pidfile usually means the process is not running.
+			st.Error = err.Error()
+		} else {
+			pidfilePid = pid
+		}
+	}
+
+	current := make(map[instanceKey]bool)
+	st.Pids = []int32{}
+	st.CPUPercent, st.RSS = 0, 0
+	for i := range procs {
+		p := &procs[i]
+		if wt.spec.Pidfile != "" && p.Pid != pidfilePid {
+			continue
+		}
+		if wt.spec.Exe != "" && p.Exe != wt.spec.Exe {
+			continue
+		}
+		if wt.cmdline != nil && !wt.cmdline.MatchString(p.Cmdline) {
+			continue
+		}
+
+		current[instanceKey{pid: p.Pid, createTime: p.CreateTime}] = true
+		st.Pids = append(st.Pids, p.Pid)
+		st.CPUPercent += p.CPUPercent
+		if p.MemoryInfo != nil {
+			st.RSS += p.MemoryInfo.RSS
+		}
+	}
+	sort.Slice(st.Pids, func(i, j int) bool { return st.Pids[i] < st.Pids[j] })
+
+	// A new instance following an exit is a restart. Instances present
+	// when the agent started, or added without any exiting, are not.
+	if wt.primed {
+		for key := range wt.instances {
+			if !current[key] {
+				wt.exited++
+			}
+		}
+		for key := range current {
+			if !wt.instances[key] && wt.exited > 0 {
+				wt.exited--
+				st.Restarts++
+			}
+		}
+	}
+	wt.instances, wt.primed = current, true
+
+	st.Instances = len(current)
+	st.Running = st.Instances >= wt.spec.MinInstances
+	if st.Instances > 0 {
+		seen := t
+		st.LastSeen = &seen
+	}
+}
+
+func (w *Watcher) snapshot() Snapshot {
+	snap := Snapshot{Time: w.time, Watches: make([]Status, 0, len(w.watches))}
+	for _, wt := range w.watches {
+		st := wt.status
+		st.Pids = append([]int32{}, st.Pids...)
+		snap.Watches = append(snap.Watches, st)
+	}
+	return snap
+}
+
+// Snapshot returns the statuses as of the last collection.
+func (w *Watcher) Snapshot() Snapshot {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.snapshot()
+}
+
+// Handler serves the status of every watch.
+func (w *Watcher) Handler(c *gin.Context) {
+	c.JSON(http.StatusOK, w.Snapshot())
+}
+
+// StatusHandler serves the status of the watch in the name path parameter.
+func (w *Watcher) StatusHandler(c *gin.Context) {
+	name := c.Param("name")
+	for _, st := range w.Snapshot().Watches {
+		if st.Name == name {
+			c.JSON(http.StatusOK, st)
+			return
+		}
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": "unknown watch " + name})
+}
@@ -1,296 +1,582 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
-
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"checker/library/alert"
+	"checker/library/auth"
+	"checker/library/certs"
+	cgroupinfo "checker/library/cgroup"
+	"checker/library/config"
 	cpuinfo "checker/library/cpu"
 	diskinfo "checker/library/disk"
 	gpuinfo "checker/library/gpu"
+	"checker/library/history"
 	hostinfo "checker/library/host"
 	memoryinfo "checker/library/memory"
+	"checker/library/metric"
 	networkinfo "checker/library/network"
+	"checker/library/notify"
+	"checker/library/oom"
+	pressureinfo "checker/library/pressure"
 	processinfo "checker/library/process"
+	"checker/library/prometheus"
+	"checker/library/sampler"
 	sensorinfo "checker/library/sensor"
+	"checker/library/stream"
+	"checker/library/watch"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	"github.com/gorilla/websocket"
 )
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
-}
-
-func configureCors() cors.Config {
-	return cors.Config{
-		AllowAllOrigins:  true,
+func configureCors(c config.CORSConfig) cors.Config {
+	corsConfig := cors.Config{
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "X-API-Key"},
 		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
+		AllowCredentials: c.AllowCredentials,
 	}
+	for _, origin := range c.AllowOrigins {
+		if origin == "*" {
+			corsConfig.AllowAllOrigins = true
+			return corsConfig
+		}
+	}
+	corsConfig.AllowOrigins = c.AllowOrigins
+	return corsConfig
 }
 
-func wsCPUInfoHandler(c *gin.Context) {
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
-	if err != nil {
-		log.Printf("Failed to set websocket upgrade for CPU info: %v", err)
-		return
+// newAuthenticator builds the authenticator from the auth config. With no
+// keys and no JWT secret configured the API stays open.
+func newAuthenticator(cfg config.AuthConfig) *auth.Authenticator {
+	keys := make([]auth.APIKey, 0, len(cfg.APIKeys))
+	for _, k := range cfg.APIKeys {
+		keys = append(keys, auth.APIKey{Name: k.Name, Key: k.Key, Scopes: k.Scopes})
 	}
-	defer conn.Close()
 
-	for {
-		data := cpuinfo.GetCPUInfo
-		if err := conn.WriteJSON(data); err != nil {
-			log.Printf("Failed to send CPU info over websocket: %v", err)
-			break
+	var jwt *auth.JWTConfig
+	if cfg.JWT != nil {
+		jwt = &auth.JWTConfig{
+			Secret:   []byte(cfg.JWT.Secret),
+			Issuer:   cfg.JWT.Issuer,
+			Audience: cfg.JWT.Audience,
+			Leeway:   time.Duration(cfg.JWT.Leeway),
 		}
 	}
+	a := auth.New(keys, jwt)
+	if len(cfg.ClientCertScopes) > 0 {
+		a.TrustClientCertificates(cfg.ClientCertScopes)
+	}
+	return a
 }
 
-func wsMemoryInfoHandler(c *gin.Context) {
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
-	if err != nil {
-		log.Printf("Failed to set websocket upgrade for Memory info: %v", err)
-		return
+// newTLSConfig loads, or in self-signed mode generates, the server
+// certificate and watches the files for rotation.
+func newTLSConfig(ctx context.Context, cfg config.TLSConfig) (*tls.Config, error) {
+	hosts := cfg.Hosts
+	if len(hosts) == 0 {
+		hosts = certs.DefaultHosts()
 	}
-	defer conn.Close()
 
-	for {
-		data := memoryinfo.GetMemoryInfo
-		if err := conn.WriteJSON(data); err != nil {
-			log.Printf("Failed to send memory info over websocket: %v", err)
-			break
-		}
+	opts := certs.Options{
+		CertFile:     cfg.CertFile,
+		KeyFile:      cfg.KeyFile,
+		ClientCAFile: cfg.ClientCAFile,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
 	}
-}
-
-func wsDiskInfoHandler(c *gin.Context) {
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
-	if err != nil {
-		log.Printf("Failed to set websocket upgrade for Disk info: %v", err)
-		return
+	if cfg.ClientAuth == "optional" {
+		opts.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	if cfg.MinVersion == "1.3" {
+		opts.MinVersion = tls.VersionTLS13
 	}
-	defer conn.Close()
 
-	for {
-		data := diskinfo.GetDiskInfo
-		if err := conn.WriteJSON(data); err != nil {
-			log.Printf("Failed to send memory info over websocket: %v", err)
-			break
+	if cfg.SelfSigned {
+		if cfg.CertFile == "" {
+			cert, err := certs.SelfSigned(hosts)
+			if err != nil {
+				return nil, err
+			}
+			opts.Certificate = cert
+			log.Printf("Serving an in-memory self-signed certificate for %s", strings.Join(hosts, ", "))
+		} else {
+			created, err := certs.EnsureSelfSigned(cfg.CertFile, cfg.KeyFile, hosts)
+			if err != nil {
+				return nil, err
+			}
+			if created {
+				log.Printf("Wrote a self-signed certificate for %s to %s", strings.Join(hosts, ", "), cfg.CertFile)
+			}
 		}
 	}
-}
 
-func wsNetworkInfoHandler(c *gin.Context) {
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	reloader, err := certs.NewReloader(opts)
 	if err != nil {
-		log.Printf("Failed to set websocket upgrade for Network info: %v", err)
-		return
+		return nil, err
+	}
+	// An in-memory certificate is never reloaded, but the client CA file
+	// still is.
+	if cfg.ReloadInterval > 0 && (cfg.CertFile != "" || cfg.ClientCAFile != "") {
+		go reloader.Watch(ctx, time.Duration(cfg.ReloadInterval))
 	}
-	defer conn.Close()
 
-	for {
-		data := networkinfo.GetNetworkInfo
-		if err := conn.WriteJSON(data); err != nil {
-			log.Printf("Failed to send memory info over websocket: %v", err)
-			break
+	// SIGHUP forces a reload, e.g. from a certificate renewal hook.
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := reloader.Reload(); err != nil {
+				log.Printf("Failed to reload TLS files: %v", err)
+				continue
+			}
+			log.Printf("Reloaded TLS files")
 		}
+	}()
+	return reloader.TLSConfig(), nil
+}
+
+// collectFunc adapts a typed collector to an untyped collect function.
+func collectFunc[T any](collect func(ctx context.Context) (T, error)) func(ctx context.Context) (interface{}, error) {
+	return func(ctx context.Context) (interface{}, error) {
+		return collect(ctx)
 	}
 }
 
-func wsNetworkPidsInfo(c *gin.Context) {
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
-	if err != nil {
-		log.Printf("Failed to set websocket upgrade for Network Interfaces info: %v", err)
-		return
+// collectorFor returns the collect function of a collector, applying its
+// collector-specific options.
+func collectorFor(name string, c config.CollectorConfig, procs *processinfo.Collector) func(ctx context.Context) (interface{}, error) {
+	switch name {
+	case "system":
+		return collectFunc(hostinfo.Collect)
+	case "cpu":
+		return collectFunc(cpuinfo.NewCollector(cpuinfo.Options{Root: c.Root}).Collect)
+	case "memory":
+		return collectFunc(memoryinfo.NewCollector().Collect)
+	case "disk":
+		opts := diskOptions(c.Partitions)
+		return collectFunc(func(ctx context.Context) (diskinfo.Snapshot, error) {
+			return diskinfo.CollectWithOptions(ctx, opts)
+		})
+	case "diskio":
+		return collectFunc(diskinfo.NewIOCollector().Collect)
+	case "network":
+		return collectFunc(networkinfo.Collect)
+	case "process":
+		return collectFunc(procs.Collect)
+	case "sensors":
+		return collectFunc(sensorinfo.Collect)
+	case "gpu":
+		opts := gpuinfo.Options{Polls: c.Polls}
+		return collectFunc(func(ctx context.Context) (gpuinfo.Snapshot, error) {
+			return gpuinfo.CollectWithOptions(ctx, opts)
+		})
+	case "pressure":
+		opts := pressureinfo.Options{Root: c.Root}
+		return collectFunc(func(ctx context.Context) (pressureinfo.Snapshot, error) {
+			return pressureinfo.CollectWithOptions(ctx, opts)
+		})
+	case "cgroup":
+		opts := cgroupinfo.Options{Root: c.Root}
+		return collectFunc(func(ctx context.Context) (cgroupinfo.Snapshot, error) {
+			return cgroupinfo.CollectWithOptions(ctx, opts)
+		})
 	}
-	defer conn.Close()
+	return nil
+}
 
-	for {
-		data := networkinfo.GetPids
-		if err := conn.WriteJSON(data); err != nil {
-			log.Printf("Failed to send network interfaces info over websocket: %v", err)
-			break
+// diskOptions overrides the default partition filter with the lists set
+// in f.
+func diskOptions(f *config.PartitionFilter) diskinfo.Options {
+	opts := diskinfo.DefaultOptions
+	if f == nil {
+		return opts
+	}
+	for _, list := range []struct {
+		from []string
+		to   *[]string
+	}{
+		{f.IncludeFstypes, &opts.Filter.IncludeFstypes},
+		{f.ExcludeFstypes, &opts.Filter.ExcludeFstypes},
+		{f.IncludeMountpoints, &opts.Filter.IncludeMountpoints},
+		{f.ExcludeMountpoints, &opts.Filter.ExcludeMountpoints},
+		{f.IncludeDevices, &opts.Filter.IncludeDevices},
+		{f.ExcludeDevices, &opts.Filter.ExcludeDevices},
+	} {
+		if list.from != nil {
+			*list.to = list.from
 		}
 	}
+	return opts
 }
 
-func wsNetworkInterfacesInfo(c *gin.Context) {
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
-	if err != nil {
-		log.Printf("Failed to set websocket upgrade for Network Interfaces info: %v", err)
-		return
+// view adapts a function on a typed snapshot to a sampler view.
+func view[T any](fn func(T) interface{}) func(interface{}) interface{} {
+	return func(v interface{}) interface{} {
+		return fn(v.(T))
 	}
-	defer conn.Close()
+}
 
-	for {
-		data := networkinfo.GetInterfaces
-		if err := conn.WriteJSON(data); err != nil {
-			log.Printf("Failed to send network interfaces info over websocket: %v", err)
-			break
-		}
+func registerCollectors(s *sampler.Sampler, cfg config.Config, procs *processinfo.Collector) {
+	for _, name := range cfg.EnabledCollectors() {
+		c := cfg.Collectors[name]
+		s.Register(name, time.Duration(c.Interval), time.Duration(c.Timeout), collectorFor(name, c, procs))
 	}
 }
 
-func wsNetworkConnectionsInfo(c *gin.Context) {
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+// newHistory creates the history store and records every sample into it.
+func newHistory(s *sampler.Sampler, cfg config.HistoryConfig) (*history.Store, error) {
+	tiers, err := history.ParseTiers(cfg.Tiers)
 	if err != nil {
-		log.Printf("Failed to set websocket upgrade for Network Connections info: %v", err)
-		return
+		return nil, err
 	}
-	defer conn.Close()
 
-	for {
-		data := networkinfo.GetConnections
-		if err := conn.WriteJSON(data); err != nil {
-			log.Printf("Failed to send network connections info over websocket: %v", err)
-			break
-		}
+	store, err := history.New(tiers, cfg.MaxSeries)
+	if err != nil {
+		return nil, err
 	}
+
+	s.OnSample(func(name string, sample sampler.Sample) {
+		if sample.Err == nil {
+			store.Record(sample.Timestamp, metric.Extract(sample.Data))
+		}
+	})
+	return store, nil
 }
 
-func wsNetworkIOCountersInfo(c *gin.Context) {
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
-	if err != nil {
-		log.Printf("Failed to set websocket upgrade for Network IO Counters info: %v", err)
-		return
+// newAlertEngine loads the rule file, if any, and evaluates the rules on
+// every sample.
+func newAlertEngine(s *sampler.Sampler, cfg config.AlertsConfig) (*alert.Engine, error) {
+	var rules []alert.Rule
+	if path := cfg.RulesFile; path != "" {
+		var err error
+		if rules, err = alert.LoadRules(path); err != nil {
+			return nil, err
+		}
+		log.Printf("Loaded %d alert rules from %s", len(rules), path)
 	}
-	defer conn.Close()
 
-	for {
-		ioCounters, err := networkinfo.GetIOCounters()
-		if err != nil {
-			log.Printf("Error getting IO counters: %v", err)
-			break
+	engine := alert.NewEngine(rules)
+	s.OnSample(func(name string, sample sampler.Sample) {
+		if sample.Err == nil {
+			engine.Evaluate(name, sample.Timestamp, metric.Extract(sample.Data))
 		}
+	})
+	return engine, nil
+}
 
-		if err := conn.WriteJSON(gin.H{"io_counters": ioCounters}); err != nil {
-			log.Printf("Failed to send network IO counters info over websocket: %v", err)
-			break
+// newLifecycle detects process starts and exits from the process sweeps
+// and forwards them to the configured webhooks.
+func newLifecycle(ctx context.Context, s *sampler.Sampler, cfg config.ProcessEventsConfig) *processinfo.Lifecycle {
+	l := processinfo.NewLifecycle()
+	s.OnSample(func(name string, sample sampler.Sample) {
+		if name == "process" && sample.Err == nil {
+			l.Observe(sample.Timestamp, sample.Data.(processinfo.Snapshot))
 		}
+	})
+
+	if len(cfg.Webhooks) > 0 {
+		hooks := make([]*notify.Webhook, 0, len(cfg.Webhooks))
+		for _, h := range cfg.Webhooks {
+			hooks = append(hooks, &notify.Webhook{URL: h.URL, Secret: h.Secret, Headers: h.Headers, Timeout: time.Duration(h.Timeout)})
+		}
+		events, _ := l.Hub().Subscribe()
+		go notify.Forward(ctx, "process", events, hooks, notify.DefaultRetry)
+		log.Printf("Sending process events to %d webhooks", len(hooks))
 	}
+	return l
 }
 
-func wsNetworkConntrackStatsInfo(c *gin.Context) {
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+// newWatcher evaluates the configured process watches on every process
+// sweep, recording their metrics and evaluating alert rules on them.
+func newWatcher(s *sampler.Sampler, cfg []config.WatchConfig, h *history.Store, a *alert.Engine) (*watch.Watcher, error) {
+	specs := make([]watch.Spec, 0, len(cfg))
+	for _, w := range cfg {
+		specs = append(specs, watch.Spec{Name: w.Name, Exe: w.Exe, Cmdline: w.Cmdline, Pidfile: w.Pidfile, MinInstances: w.MinInstances})
+	}
+	w, err := watch.New(specs)
 	if err != nil {
-		log.Printf("Failed to set websocket upgrade for Network Conntrack Stats info: %v", err)
-		return
+		return nil, err
 	}
-	defer conn.Close()
 
-	for {
-		conntrackstats, err := networkinfo.GetConntrackStats()
-		if err != nil {
-			log.Printf("Error getting Conntrack Stats: %v", err)
-			break
+	s.OnSample(func(name string, sample sampler.Sample) {
+		if name != "process" || sample.Err != nil {
+			return
 		}
+		points := metric.Extract(w.Observe(sample.Timestamp, sample.Data.(processinfo.Snapshot)))
+		h.Record(sample.Timestamp, points)
+		a.Evaluate("watches", sample.Timestamp, points)
+	})
+	return w, nil
+}
 
-		if err := conn.WriteJSON(gin.H{"conntrack_stats": conntrackstats}); err != nil {
-			log.Printf("Failed to send network conntrack stats info over websocket: %v", err)
-			break
+// newOOMDetector watches the memory and cgroup samples for OOM kills,
+// attributing them to processes that exited between two process sweeps,
+// and records the recent kill counts and evaluates alert rules on them.
+func newOOMDetector(s *sampler.Sampler, h *history.Store, a *alert.Engine) *oom.Detector {
+	d := oom.NewDetector()
+	s.OnSample(func(name string, sample sampler.Sample) {
+		if sample.Err != nil {
+			return
 		}
-	}
+		switch name {
+		case "process":
+			d.ObserveProcesses(sample.Timestamp, sample.Data.(processinfo.Snapshot))
+			return
+		case "memory":
+			d.ObserveMemory(sample.Timestamp, sample.Data.(memoryinfo.Snapshot))
+		case "cgroup":
+			d.ObserveCgroups(sample.Timestamp, sample.Data.(cgroupinfo.Snapshot))
+		default:
+			return
+		}
+		points := metric.Extract(d.Snapshot(sample.Timestamp))
+		h.Record(sample.Timestamp, points)
+		a.Evaluate("oom", sample.Timestamp, points)
+	})
+	return d
 }
 
-func wsProcessInfoHandler(c *gin.Context) {
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+// startNotifications delivers alert state changes to the receivers in the
+// notification config, if any.
+func startNotifications(ctx context.Context, a *alert.Engine, cfg config.AlertsConfig) error {
+	path := cfg.NotifyFile
+	if path == "" {
+		return nil
+	}
+
+	notifyConfig, err := notify.LoadConfig(path)
+	if err != nil {
+		return err
+	}
+	d, err := notify.NewDispatcher(notifyConfig)
 	if err != nil {
-		log.Printf("Failed to set websocket upgrade for Process info: %v", err)
-		return
+		return err
 	}
-	defer conn.Close()
 
-	for {
-		data := processinfo.GetProcessInfo
-		if err := conn.WriteJSON(data); err != nil {
-			log.Printf("Failed to send memory info over websocket: %v", err)
-			break
-		}
+	events, _ := a.Hub().Subscribe()
+	go d.Run(ctx, events)
+	log.Printf("Sending alert notifications to %d receivers", len(notifyConfig.Receivers))
+	return nil
+}
+
+// processQuery serves /metrics/process from the cached sweep, applying the
+// request's filters and fetching heavy fields for the selected processes.
+func processQuery(timeout time.Duration) func(c *gin.Context, data interface{}) {
+	return func(c *gin.Context, data interface{}) {
+		processinfo.Respond(c, data.(processinfo.Snapshot), timeout)
 	}
 }
 
-func wsSensorInfoHandler(c *gin.Context) {
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
-	if err != nil {
-		log.Printf("Failed to set websocket upgrade for Sensor info: %v", err)
-		return
+// processTree serves /metrics/process/tree from the cached sweep.
+func processTree(c *gin.Context, data interface{}) {
+	processinfo.RespondTree(c, data.(processinfo.Snapshot))
+}
+
+// processStream is the websocket variant of processQuery: the query is
+// parsed once from the upgrade request and applied to every snapshot.
+func processStream(streamer *stream.Streamer, s *sampler.Sampler, timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		q, err := processinfo.ParseQuery(c.Request.URL.Query())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		streamer.Handler("Process", func(ctx context.Context) (interface{}, error) {
+			snap, _, err := sampler.Get[processinfo.Snapshot](ctx, s, "process")
+			if err != nil {
+				return nil, err
+			}
+			out, _, err := q.Run(ctx, snap, timeout)
+			return out, err
+		})(c)
 	}
-	defer conn.Close()
+}
 
-	for {
-		data := sensorinfo.GetSensorInfo
-		if err := conn.WriteJSON(data); err != nil {
-			log.Printf("Failed to send memory info over websocket: %v", err)
-			break
+// processDetailStream streams the detail of the process in the pid path
+// parameter, read live on every tick.
+func processDetailStream(streamer *stream.Streamer, procs *processinfo.Collector) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		pid, opts, err := procs.ParseDetailRequest(c)
+		if err != nil {
+			c.JSON(processinfo.DetailRequestStatus(err), gin.H{"error": err.Error()})
+			return
 		}
+		// Refuse the upgrade rather than streaming errors for a missing pid.
+		if !processinfo.Exists(c.Request.Context(), pid) {
+			c.JSON(http.StatusNotFound, gin.H{"error": processinfo.ErrNotFound.Error()})
+			return
+		}
+
+		streamer.Handler("Process "+c.Param("pid"), func(ctx context.Context) (interface{}, error) {
+			return procs.Detail(ctx, pid, opts)
+		})(c)
 	}
 }
 
-func wsGpuInfoHandler(c *gin.Context) {
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
-	if err != nil {
-		log.Printf("Failed to set websocket upgrade for GPU info: %v", err)
-		return
+func initializeRoutes(r *gin.Engine, cfg config.Config, authn *auth.Authenticator, streamer *stream.Streamer,
+	s *sampler.Sampler, procs *processinfo.Collector, lifecycle *processinfo.Lifecycle, h *history.Store, a *alert.Engine, w *watch.Watcher,
+	oomDetector *oom.Detector) {
+	processTimeout := time.Duration(cfg.Collectors["process"].PerProcessTimeout)
+
+	diskView := view(func(snap diskinfo.Snapshot) interface{} { return snap.Partitions })
+	networkView := view(func(snap networkinfo.Snapshot) interface{} { return snap.Sections() })
+	gpuView := view(func(snap gpuinfo.Snapshot) interface{} { return snap.Samples })
+
+	metrics := r.Group("/metrics", authn.Require(auth.ScopeMetrics))
+	{
+		metrics.GET("/system", s.Handler("system", nil))
+		metrics.GET("/cpu", s.Handler("cpu", nil))
+		metrics.GET("/memory", s.Handler("memory", nil))
+		metrics.GET("/memory/oom", oomDetector.Handler)
+		metrics.GET("/pressure", s.Handler("pressure", nil))
+		metrics.GET("/disk", s.Handler("disk", diskView))
+		metrics.GET("/disk/io", s.Handler("diskio", nil))
+		metrics.GET("/network", s.Handler("network", networkView))
+		metrics.GET("/process", s.Serve("process", processQuery(processTimeout)))
+		metrics.GET("/process/tree", s.Serve("process", processTree))
+		metrics.GET("/process/events", lifecycle.Handler)
+		metrics.GET("/process/:pid", procs.GetProcessDetail)
+		metrics.GET("/sensors", s.Handler("sensors", nil))
+		metrics.GET("/gpu", s.Handler("gpu", gpuView))
+		metrics.GET("/cgroup", s.Handler("cgroup", nil))
+		metrics.GET("/prometheus", prometheus.Handler(s))
 	}
-	defer conn.Close()
 
-	for {
-		data := gpuinfo.GetGpuInfo
-		if err := conn.WriteJSON(data); err != nil {
-			log.Printf("Failed to send memory info over websocket: %v", err)
-			break
-		}
+	r.GET("/history", authn.Require(auth.ScopeHistory), h.ListHandler)
+	r.GET("/history/:metric", authn.Require(auth.ScopeHistory), h.QueryHandler)
+
+	r.GET("/alerts", authn.Require(auth.ScopeAlerts), a.Handler)
+
+	r.GET("/watches", authn.Require(auth.ScopeMetrics), w.Handler)
+	r.GET("/watches/:name", authn.Require(auth.ScopeMetrics), w.StatusHandler)
+
+	ws := r.Group("/ws", authn.Require(auth.ScopeStream))
+	{
+		ws.GET("/cpu", streamer.Handler("CPU", s.Cached("cpu", nil)))
+		ws.GET("/memory", streamer.Handler("Memory", s.Cached("memory", nil)))
+		ws.GET("/memory/oom", streamer.EventHandler("OOM", oomDetector.Hub(), nil))
+		ws.GET("/pressure", streamer.Handler("Pressure", s.Cached("pressure", nil)))
+		ws.GET("/disk", streamer.Handler("Disk", s.Cached("disk", diskView)))
+		ws.GET("/disk/io", streamer.Handler("Disk IO", s.Cached("diskio", nil)))
+		ws.GET("/network", streamer.Handler("Network", s.Cached("network", networkView)))
+		ws.GET("/network/pids", streamer.Handler("Network PIDs", s.Cached("network",
+			view(func(snap networkinfo.Snapshot) interface{} { return gin.H{"pids": snap.Pids} }))))
+		ws.GET("/network/interfaces", streamer.Handler("Network Interfaces", s.Cached("network",
+			view(func(snap networkinfo.Snapshot) interface{} { return gin.H{"interfaces": snap.Interfaces} }))))
+		ws.GET("/network/connections", streamer.Handler("Network Connections", s.Cached("network",
+			view(func(snap networkinfo.Snapshot) interface{} { return gin.H{"connections": snap.Connections} }))))
+		ws.GET("/network/iocounters", streamer.Handler("Network IO Counters", s.Cached("network",
+			view(func(snap networkinfo.Snapshot) interface{} { return gin.H{"io_counters": snap.NicIOCounters} }))))
+		ws.GET("/network/conntracksstats", streamer.Handler("Network Conntrack Stats", s.Cached("network",
+			view(func(snap networkinfo.Snapshot) interface{} { return gin.H{"conntrack_stats": snap.ConntrackStats} }))))
+		ws.GET("/process", processStream(streamer, s, processTimeout))
+		ws.GET("/process/events", streamer.EventHandler("Process", lifecycle.Hub(), nil))
+		ws.GET("/process/:pid", processDetailStream(streamer, procs))
+		ws.GET("/sensors", streamer.Handler("Sensor", s.Cached("sensors", nil)))
+		ws.GET("/gpu", streamer.Handler("GPU", s.Cached("gpu", gpuView)))
+		ws.GET("/cgroup", streamer.Handler("Cgroup", s.Cached("cgroup", nil)))
+		ws.GET("/alerts", authn.Require(auth.ScopeAlerts), streamer.EventHandler("Alert", a.Hub(), func() interface{} { return a.Alerts("") }))
 	}
 }
 
-func initializeRoutes(r *gin.Engine) {
-	metrics := r.Group("/metrics")
-	{
-		metrics.GET("/system", hostinfo.GetSystemInfo)
-		metrics.GET("/cpu", cpuinfo.GetCPUInfo)
-		metrics.GET("/memory", memoryinfo.GetMemoryInfo)
-		metrics.GET("/disk", diskinfo.GetDiskInfo)
-		metrics.GET("/network", networkinfo.GetNetworkInfo)
-		metrics.GET("/process", processinfo.GetProcessInfo)
-		metrics.GET("/sensors", sensorinfo.GetSensorInfo)
-		metrics.GET("/gpu", gpuinfo.GetGpuInfo)
-	}
-
-	r.GET("/ws/cpu", wsCPUInfoHandler)
-	r.GET("/ws/memory", wsMemoryInfoHandler)
-	r.GET("/ws/disk", wsDiskInfoHandler)
-	r.GET("/ws/network", wsNetworkInfoHandler)
-	r.GET("/ws/network/pids", wsNetworkPidsInfo)
-	r.GET("/ws/network/interfaces", wsNetworkInterfacesInfo)
-	r.GET("/ws/network/connections", wsNetworkConnectionsInfo)
-	r.GET("/ws/network/iocounters", wsNetworkIOCountersInfo)
-	r.GET("/ws/network/conntracksstats", wsNetworkConntrackStatsInfo)
-	r.GET("/ws/process", wsProcessInfoHandler)
-	r.GET("/ws/sensors", wsSensorInfoHandler)
-	r.GET("/ws/gpu", wsGpuInfoHandler)
+// logFormatter formats request logs like gin's default logger, without
+// the websocket access tokens in request URLs.
+func logFormatter(p gin.LogFormatterParams) string {
+	if p.Latency > time.Minute {
+		p.Latency = p.Latency.Truncate(time.Second)
+	}
+	return fmt.Sprintf("[GIN] %v | %3d | %13v | %15s | %-7s %#v\n%s",
+		p.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		p.StatusCode,
+		p.Latency,
+		p.ClientIP,
+		p.Method,
+		auth.RedactToken(p.Path),
+		p.ErrorMessage,
+	)
 }
 
 func main() {
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
 	gin.SetMode(gin.ReleaseMode)
 
-	r := gin.Default()
-	r.Use(cors.New(configureCors()))
+	r := gin.New()
+	r.Use(gin.LoggerWithFormatter(logFormatter), gin.Recovery())
+	r.Use(cors.New(configureCors(cfg.CORS)))
 
-	initializeRoutes(r)
+	authn := newAuthenticator(cfg.Auth)
+	if !authn.Enabled() {
+		log.Printf("Warning: no API keys or JWT secret configured, the API is open to anyone who can reach %s", cfg.Listen)
+	}
+	streamer := stream.New(auth.OriginChecker(cfg.CORS.AllowOrigins))
+
+	// The process collector keeps per-process counters between sweeps,
+	// which the detail endpoints compute their rates against.
+	procs := processinfo.NewCollector(processinfo.Options{
+		PerProcessTimeout: time.Duration(cfg.Collectors["process"].PerProcessTimeout),
+		AllowEnviron:      cfg.Collectors["process"].AllowEnviron,
+	})
+
+	s := sampler.New()
+	registerCollectors(s, cfg, procs)
+	if depth := cfg.Collectors["cgroup"].MetricDepth; depth != nil {
+		metric.CgroupDepth = *depth
+	}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "33551"
+	h, err := newHistory(s, cfg.History)
+	if err != nil {
+		log.Fatalf("Failed to set up history: %v", err)
+	}
+	a, err := newAlertEngine(s, cfg.Alerts)
+	if err != nil {
+		log.Fatalf("Failed to set up alerting: %v", err)
+	}
+	if err := startNotifications(context.Background(), a, cfg.Alerts); err != nil {
+		log.Fatalf("Failed to set up notifications: %v", err)
 	}
+	lifecycle := newLifecycle(context.Background(), s, cfg.ProcessEvents)
+	w, err := newWatcher(s, cfg.Watches, h, a)
+	if err != nil {
+		log.Fatalf("Failed to set up process watches: %v", err)
+	}
+	oomDetector := newOOMDetector(s, h, a)
+	go s.Run(context.Background())
+
+	initializeRoutes(r, cfg, authn, streamer, s, procs, lifecycle, h, a, w, oomDetector)
 
-	log.Printf("Starting server on port %s...", port)
-	if err := r.Run(":" + port); err != nil {
+	server := &http.Server{
+		Addr:              cfg.Listen,
+		Handler:           r,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	if cfg.TLS.Enabled() {
+		server.TLSConfig, err = newTLSConfig(context.Background(), cfg.TLS)
+		if err != nil {
+			log.Fatalf("Failed to set up TLS: %v", err)
+		}
+		log.Printf("Starting HTTPS server on %s...", cfg.Listen)
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		log.Printf("Starting server on %s...", cfg.Listen)
+		err = server.ListenAndServe()
+	}
+	if err != nil {
 		log.Fatalf("Failed to run server: %v", err)
 	}
 }